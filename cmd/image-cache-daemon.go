@@ -32,10 +32,17 @@ import (
 	argoclientset "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/dcherman/image-cache-daemon/puller"
 	"github.com/dcherman/image-cache-daemon/source"
@@ -45,17 +52,75 @@ import (
 func NewImageCacheDaemonCommand() *cobra.Command {
 	var (
 		images            []string
+		imageFiles        []string
 		configmapSelector string
+		secretSelector    string
+		secretNamespace   string
+		workloadSelector  string
+		jobSelector       string
+		argoCDSelector    string
+		argoCDProjects    []string
+		rolloutSelector   string
+		fluxSelector      string
+		fluxAPIVersion    string
 		nodeName          string
 		podName           string
 		podUUID           string
 		podNamespace      string
+		podMinCount       int
+		podMinNamespaces  int
+
+		maxConcurrentPulls int
+
+		customResourceRules []string
+		annotationResources []string
+
+		imageURL                string
+		imageURLPollInterval    time.Duration
+		imageURLBearerTokenFile string
+		imageURLCAFile          string
+
+		registryTagRules     []string
+		registryPollInterval time.Duration
+		registrySecret       string
+
+		watchPullEvents      bool
+		pullEventMinDuration time.Duration
+
+		namespaces        []string
+		namespaceSelector string
+
+		cronLeadWindow time.Duration
+		cronRunGrace   time.Duration
+
+		writePolicyStatus    bool
+		policyStatusInterval time.Duration
+		daemonSelector       string
+
+		argoControllerConfigMapNamespace string
+		argoControllerConfigMapName      string
+		argoExecutorDefaultImage         string
 
 		wardenImage                       string
 		watchArgoWorkflowTemplates        bool
 		watchArgoClusterWorkflowTemplates bool
 		watchArgoCronWorkflows            bool
+		watchArgoWorkflows                bool
+		watchArgoExecutor                 bool
+		watchArgoCDApplications           bool
+		watchArgoRollouts                 bool
+		watchFluxImagePolicies            bool
+		watchImageCachePolicies           bool
 		watchConfigMaps                   bool
+		reportConfigMapErrors             bool
+		annotateConfigMapErrors           bool
+		watchSecrets                      bool
+		watchHelmReleases                 bool
+		watchWorkloads                    bool
+		watchJobs                         bool
+		skipSuspendedJobs                 bool
+		watchPods                         bool
+		watchAnnotations                  bool
 		resyncPeriod                      time.Duration
 	)
 
@@ -75,8 +140,16 @@ func NewImageCacheDaemonCommand() *cobra.Command {
 				panic(err)
 			}
 
+			// The nodeSelectors and platforms of ConfigMap entries and ImageCachePolicies are matched against
+			// the node, which would never be found without its name
+			if nodeName == "" && (watchConfigMaps || watchImageCachePolicies) {
+				logrus.Fatal("--node-name (or the NODE_NAME environment variable) is required to watch ConfigMaps or ImageCachePolicies")
+			}
+
 			kubeclient := kubernetes.NewForConfigOrDie(config)
 			argoclient := argoclientset.NewForConfigOrDie(config)
+			dynamicclient := dynamic.NewForConfigOrDie(config)
+			metadataclient := metadata.NewForConfigOrDie(config)
 
 			if err != nil {
 				panic(err)
@@ -98,7 +171,32 @@ func NewImageCacheDaemonCommand() *cobra.Command {
 
 			go strat.MonitorPods(ctx)
 
-			ip := puller.NewImagePuller(strat, kubeclient, podNamespace, podName)
+			ip := puller.NewImagePuller(&puller.ImagePullerOpts{
+				Strategy:           strat,
+				KubeClient:         kubeclient,
+				NodeName:           nodeName,
+				PodNamespace:       podNamespace,
+				PodName:            podName,
+				MaxConcurrentPulls: maxConcurrentPulls,
+				ReportCachedImages: watchImageCachePolicies && writePolicyStatus,
+			})
+
+			namespaceScope, err := source.NewNamespaceScope(kubeclient, namespaces, namespaceSelector)
+
+			if err != nil {
+				logrus.Fatalf("invalid namespace selector: %v", err)
+			}
+
+			go namespaceScope.Run(ctx)
+
+			// withNamespaceScope restricts sources of namespaced resources to --namespaces and --namespace-selector
+			withNamespaceScope := func(src source.ImageSource) source.ImageSource {
+				if scoped, ok := src.(source.NamespaceScopedSource); ok {
+					scoped.SetNamespaceScope(namespaceScope)
+				}
+
+				return src
+			}
 
 			if len(images) > 0 {
 				staticSource := source.NewStaticImageSource(images, 0)
@@ -106,35 +204,260 @@ func NewImageCacheDaemonCommand() *cobra.Command {
 				go staticSource.Run(ctx)
 			}
 
+			if len(imageFiles) > 0 {
+				logrus.Info("watching files for images to pull")
+				fileSource := source.NewFileSource(imageFiles)
+				ip.AddSource(ctx, fileSource)
+				go fileSource.Run(ctx)
+			}
+
+			if imageURL != "" {
+				logrus.Infof("polling %s for images to pull", imageURL)
+				httpSource, err := source.NewHTTPSource(&source.HTTPSourceOpts{
+					URL:             imageURL,
+					PollInterval:    imageURLPollInterval,
+					BearerTokenFile: imageURLBearerTokenFile,
+					CAFile:          imageURLCAFile,
+				})
+
+				if err != nil {
+					logrus.Fatalf("failed to create http source: %v", err)
+				}
+
+				ip.AddSource(ctx, httpSource)
+				go httpSource.Run(ctx)
+			}
+
+			if len(registryTagRules) > 0 {
+				var rules []source.RegistryTagRule
+
+				for _, r := range registryTagRules {
+					rule, err := source.ParseRegistryTagRule(r)
+
+					if err != nil {
+						logrus.Fatalf("invalid registry tag rule: %v", err)
+					}
+
+					rules = append(rules, *rule)
+				}
+
+				logrus.Info("watching registry tags for images to pull")
+				registrySource, err := source.NewRegistrySource(&source.RegistrySourceOpts{
+					Rules:           rules,
+					PollInterval:    registryPollInterval,
+					Client:          kubeclient,
+					SecretNamespace: podNamespace,
+					SecretName:      registrySecret,
+				})
+
+				if err != nil {
+					logrus.Fatalf("failed to create registry source: %v", err)
+				}
+
+				ip.AddSource(ctx, registrySource)
+				go registrySource.Run(ctx)
+			}
+
+			// cronWindow restricts the images of CronWorkflows and CronJobs to the time around their runs
+			var cronWindow *source.CronWindow
+
+			if cronLeadWindow > 0 {
+				cronWindow = source.NewCronWindow(cronLeadWindow, cronRunGrace)
+			}
+
+			var argoOpts []source.ArgoOptFn
+
+			if watchArgoWorkflowTemplates || watchArgoClusterWorkflowTemplates || watchArgoCronWorkflows || watchArgoWorkflows {
+				resolver := source.NewTemplateResolver(argoclient, resyncPeriod)
+				resolver.SetNamespaceScope(namespaceScope)
+				argoOpts = append(argoOpts, source.WithTemplateResolver(resolver))
+				go resolver.Run(ctx)
+			}
+
 			if watchArgoWorkflowTemplates {
 				logrus.Info("watching workflow templates for images to pull")
 
-				workflowTemplateSource := source.NewWorkflowTemplateSource(argoclient, resyncPeriod)
+				workflowTemplateSource := withNamespaceScope(source.NewWorkflowTemplateSource(argoclient, resyncPeriod, argoOpts...))
 				ip.AddSource(ctx, workflowTemplateSource)
 				go workflowTemplateSource.Run(ctx)
 			}
 
 			if watchArgoClusterWorkflowTemplates {
 				logrus.Info("watching cluster workflow templates for images to pull")
-				workflowTemplateSource := source.NewClusterWorkflowTemplateSource(argoclient, resyncPeriod)
+				workflowTemplateSource := source.NewClusterWorkflowTemplateSource(argoclient, resyncPeriod, argoOpts...)
 				ip.AddSource(ctx, workflowTemplateSource)
 				go workflowTemplateSource.Run(ctx)
 			}
 
 			if watchArgoCronWorkflows {
 				logrus.Info("watching cron workflows for images to pull")
-				workflowTemplateSource := source.NewCronWorkflowTemplateSource(argoclient, resyncPeriod)
+				workflowTemplateSource := withNamespaceScope(source.NewCronWorkflowTemplateSource(argoclient, resyncPeriod, append(argoOpts, source.WithCronWindow(cronWindow))...))
 				ip.AddSource(ctx, workflowTemplateSource)
 				go workflowTemplateSource.Run(ctx)
 			}
 
+			if watchArgoWorkflows {
+				logrus.Info("watching in-flight workflows for images to pull")
+				workflowSource := withNamespaceScope(source.NewWorkflowSource(argoclient, resyncPeriod, argoOpts...))
+				ip.AddSource(ctx, workflowSource)
+				go workflowSource.Run(ctx)
+			}
+
+			if watchArgoExecutor {
+				logrus.Info("watching the workflow controller configmap for executor images to pull")
+				argoExecutorSource := source.NewArgoExecutorSource(kubeclient, resyncPeriod, argoControllerConfigMapNamespace, argoControllerConfigMapName, argoExecutorDefaultImage)
+				ip.AddSource(ctx, argoExecutorSource)
+				go argoExecutorSource.Run(ctx)
+			}
+
+			if watchArgoCDApplications {
+				logrus.Info("watching argo cd applications for images to pull")
+				argoCDSource := withNamespaceScope(source.NewArgoCDApplicationSource(dynamicclient, resyncPeriod, argoCDSelector, argoCDProjects))
+				ip.AddSource(ctx, argoCDSource)
+				go argoCDSource.Run(ctx)
+			}
+
+			if watchArgoRollouts {
+				logrus.Info("watching argo rollouts for images to pull")
+				rolloutSource := withNamespaceScope(source.NewArgoRolloutSource(dynamicclient, resyncPeriod, rolloutSelector))
+				ip.AddSource(ctx, rolloutSource)
+				go rolloutSource.Run(ctx)
+			}
+
+			if watchFluxImagePolicies {
+				logrus.Info("watching flux image policies for images to pull")
+				fluxSource := withNamespaceScope(source.NewFluxImagePolicySource(dynamicclient, resyncPeriod, fluxAPIVersion, fluxSelector))
+				ip.AddSource(ctx, fluxSource)
+				go fluxSource.Run(ctx)
+			}
+
+			if watchImageCachePolicies {
+				logrus.Info("watching image cache policies for images to pull")
+				policySource := withNamespaceScope(source.NewImageCachePolicySource(dynamicclient, kubeclient, resyncPeriod, nodeName))
+				ip.AddSource(ctx, policySource)
+				go policySource.Run(ctx)
+
+				if writePolicyStatus {
+					go source.RunElectedImageCachePolicyStatusWriter(ctx, kubeclient, podNamespace, podName, func() *source.ImageCachePolicyStatusWriter {
+						statusWriter := source.NewImageCachePolicyStatusWriter(dynamicclient, kubeclient, podNamespace, daemonSelector, policyStatusInterval)
+						statusWriter.SetNamespaceScope(namespaceScope)
+						return statusWriter
+					})
+				}
+			}
+
 			if watchConfigMaps {
 				logrus.Info("watching configmaps for images to pull")
-				configmapSource := source.NewConfigMapSource(kubeclient, resyncPeriod, source.WithConfigMapSelector(configmapSelector))
+				configmapOpts := []source.OptFn{source.WithConfigMapSelector(configmapSelector)}
+
+				if reportConfigMapErrors || annotateConfigMapErrors {
+					configmapOpts = append(configmapOpts, source.WithConfigMapReportElection(podNamespace, podName))
+				}
+
+				if annotateConfigMapErrors {
+					configmapOpts = append(configmapOpts, source.WithConfigMapLastErrorAnnotation())
+				}
+
+				if reportConfigMapErrors {
+					broadcaster := record.NewBroadcaster()
+					broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclient.CoreV1().Events("")})
+					defer broadcaster.Shutdown()
+
+					recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "image-cache-daemon", Host: nodeName})
+					configmapOpts = append(configmapOpts, source.WithConfigMapEventRecorder(recorder))
+				}
+
+				configmapSource := withNamespaceScope(source.NewConfigMapSource(kubeclient, resyncPeriod, configmapOpts...))
 				ip.AddSource(ctx, configmapSource)
 				go configmapSource.Run(ctx)
 			}
 
+			if watchSecrets {
+				logrus.Info("watching secrets for images to pull")
+				secretSource := withNamespaceScope(source.NewSecretSource(kubeclient, resyncPeriod, source.WithSecretSelector(secretSelector), source.WithSecretNamespace(secretNamespace)))
+				ip.AddSource(ctx, secretSource)
+				go secretSource.Run(ctx)
+			}
+
+			if watchHelmReleases {
+				logrus.Info("watching helm releases for images to pull")
+				helmSource := withNamespaceScope(source.NewHelmSource(kubeclient, resyncPeriod))
+				ip.AddSource(ctx, helmSource)
+				go helmSource.Run(ctx)
+			}
+
+			if watchWorkloads {
+				logrus.Info("watching workloads for images to pull")
+				workloadSource := withNamespaceScope(source.NewWorkloadSource(kubeclient, resyncPeriod, workloadSelector))
+				ip.AddSource(ctx, workloadSource)
+				go workloadSource.Run(ctx)
+			}
+
+			if watchJobs {
+				logrus.Info("watching jobs and cronjobs for images to pull")
+				jobSource := withNamespaceScope(source.NewJobSource(kubeclient, resyncPeriod, jobSelector, skipSuspendedJobs, cronWindow))
+				ip.AddSource(ctx, jobSource)
+				go jobSource.Run(ctx)
+			}
+
+			if watchPods {
+				logrus.Info("watching running pods for images to pull")
+				podSource := withNamespaceScope(source.NewPodSource(kubeclient, resyncPeriod, podMinCount, podMinNamespaces))
+				ip.AddSource(ctx, podSource)
+				go podSource.Run(ctx)
+			}
+
+			if watchPullEvents {
+				logrus.Info("watching image pull events for images to pull")
+				eventSource := withNamespaceScope(source.NewEventSource(kubeclient, resyncPeriod, pullEventMinDuration, podNamespace))
+				ip.AddSource(ctx, eventSource)
+				go eventSource.Run(ctx)
+			}
+
+			if watchAnnotations {
+				var resources []schema.GroupVersionResource
+
+				for _, r := range annotationResources {
+					gvr, err := source.ParseGroupVersionResource(r)
+
+					if err != nil {
+						logrus.Fatalf("invalid annotation resource: %v", err)
+					}
+
+					resources = append(resources, gvr)
+				}
+
+				logrus.Info("watching annotated resources for images to pull")
+				annotationSource := withNamespaceScope(source.NewAnnotationSource(metadataclient, resyncPeriod, resources))
+				ip.AddSource(ctx, annotationSource)
+				go annotationSource.Run(ctx)
+			}
+
+			if len(customResourceRules) > 0 {
+				var rules []source.CustomResourceRule
+
+				for _, r := range customResourceRules {
+					rule, err := source.ParseCustomResourceRule(r)
+
+					if err != nil {
+						logrus.Fatalf("invalid custom resource rule: %v", err)
+					}
+
+					rules = append(rules, *rule)
+				}
+
+				logrus.Info("watching custom resources for images to pull")
+				customResourceSource, err := source.NewCustomResourceSource(dynamicclient, resyncPeriod, rules)
+
+				if err != nil {
+					logrus.Fatalf("failed to create custom resource source: %v", err)
+				}
+
+				withNamespaceScope(customResourceSource)
+				ip.AddSource(ctx, customResourceSource)
+				go customResourceSource.Run(ctx)
+			}
+
 			go ip.Run(ctx)
 
 			stopCh := make(chan os.Signal, 1)
@@ -151,16 +474,65 @@ func NewImageCacheDaemonCommand() *cobra.Command {
 	}
 
 	rootCmd.Flags().StringArrayVar(&images, "image", []string{}, "Images that should be pre-fetched")
-	rootCmd.Flags().StringVar(&nodeName, "node-name", os.Getenv("POD_NODE_NAME"), "The node name to pull to")
+	rootCmd.Flags().StringArrayVar(&imageFiles, "image-file", []string{}, "Files or directories containing lists of images that should be pre-fetched.  Reloaded whenever they change.  May be provided multiple times")
+	rootCmd.Flags().StringVar(&imageURL, "image-url", "", "A URL serving a JSON or YAML list of images that should be pre-fetched")
+	rootCmd.Flags().DurationVar(&imageURLPollInterval, "image-url-poll-interval", time.Minute*5, "How often the --image-url should be polled")
+	rootCmd.Flags().StringVar(&imageURLBearerTokenFile, "image-url-bearer-token-file", "", "A file containing a bearer token to send when polling the --image-url")
+	rootCmd.Flags().StringVar(&imageURLCAFile, "image-url-ca-file", "", "A PEM encoded CA bundle used to verify the --image-url instead of the system roots")
+	rootCmd.Flags().StringArrayVar(&registryTagRules, "registry-tag-rule", []string{}, "A rule of the form repository=<repository>;semver=<constraint>;regex=<regex>;count=<n> selecting the newest tags of a repository to pre-fetch.  May be provided multiple times")
+	rootCmd.Flags().DurationVar(&registryPollInterval, "registry-poll-interval", time.Minute*15, "How often registries should be polled for new tags")
+	rootCmd.Flags().StringVar(&registrySecret, "registry-secret", "", "The name of a kubernetes.io/dockerconfigjson Secret in --pod-namespace holding registry credentials for --registry-tag-rule")
+	rootCmd.Flags().StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "The node name to pull to, which is required to watch ConfigMaps or ImageCachePolicies.  Defaults to the NODE_NAME environment variable")
 	rootCmd.Flags().StringVar(&podName, "pod-name", os.Getenv("POD_NAME"), "The pod name")
-	rootCmd.Flags().StringVar(&podUUID, "pod-uid", os.Getenv("POD_UUD"), "The owning pod UID")
+	rootCmd.Flags().StringVar(&podUUID, "pod-uid", os.Getenv("POD_UID"), "The owning pod UID")
 	rootCmd.Flags().StringVar(&podNamespace, "pod-namespace", os.Getenv("POD_NAMESPACE"), "The namespace this pod is running in")
+	rootCmd.Flags().IntVar(&maxConcurrentPulls, "max-concurrent-pulls", 0, "The number of images that may be pulled at once.  Further images are queued, highest priority first.  Set to 0 to disable.")
 	rootCmd.Flags().StringVar(&wardenImage, "warden-image", "exiges/image-cache-warden:latest", "The image that copies a binary to pulled containers to replace the entrypoint")
 	rootCmd.Flags().StringVar(&configmapSelector, "configmap-selector", "app.kubernetes.io/part-of=image-cache-daemon", "The selector to use when monitoring for ConfigMap sources")
 	rootCmd.Flags().BoolVar(&watchArgoWorkflowTemplates, "watch-argo-workflow-templates", true, "Whether or not to watch workflow templates")
 	rootCmd.Flags().BoolVar(&watchArgoClusterWorkflowTemplates, "watch-argo-cluster-workflow-templates", true, "Whether or not to watch cluster workflow templates")
 	rootCmd.Flags().BoolVar(&watchArgoCronWorkflows, "watch-argo-cron-workflows", true, "Whether or not to watch cron workflows")
+	rootCmd.Flags().BoolVar(&watchArgoWorkflows, "watch-argo-workflows", false, "Whether or not to watch pending and running workflows")
+	rootCmd.Flags().BoolVar(&watchArgoExecutor, "watch-argo-executor", false, "Whether or not to watch the workflow controller configmap for the executor image")
+	rootCmd.Flags().StringVar(&argoControllerConfigMapNamespace, "argo-controller-configmap-namespace", "argo", "The namespace of the workflow controller configmap")
+	rootCmd.Flags().StringVar(&argoControllerConfigMapName, "argo-controller-configmap-name", "workflow-controller-configmap", "The name of the workflow controller configmap")
+	rootCmd.Flags().StringVar(&argoExecutorDefaultImage, "argo-executor-default-image", "", "The executor image to cache when the workflow controller configmap sets neither executor.image nor executorImage, such as quay.io/argoproj/argoexec:v3.2.11.  The controller then runs the argoexec image that it was built with, which cannot be read from the configmap, so no executor image is cached unless this is set to the version of the controller")
+	rootCmd.Flags().BoolVar(&watchArgoCDApplications, "watch-argocd-applications", false, "Whether or not to watch Argo CD Applications for images to pull.  Must match the --argocd-application-selector")
+	rootCmd.Flags().StringVar(&argoCDSelector, "argocd-application-selector", "", "The selector to use when monitoring for Argo CD Application sources.  Defaults to all Applications")
+	rootCmd.Flags().StringArrayVar(&argoCDProjects, "argocd-project", []string{}, "An Argo CD project whose Applications should be considered.  May be provided multiple times.  Defaults to all projects")
+	rootCmd.Flags().BoolVar(&watchArgoRollouts, "watch-argo-rollouts", false, "Whether or not to watch Argo Rollouts for images to pull.  Must match the --argo-rollout-selector")
+	rootCmd.Flags().StringVar(&rolloutSelector, "argo-rollout-selector", "", "The selector to use when monitoring for Argo Rollout sources.  Defaults to all Rollouts")
+	rootCmd.Flags().BoolVar(&watchFluxImagePolicies, "watch-flux-image-policies", false, "Whether or not to watch Flux ImagePolicies for images to pull.  Must match the --flux-image-policy-selector")
+	rootCmd.Flags().StringVar(&fluxSelector, "flux-image-policy-selector", "", "The selector to use when monitoring for Flux ImagePolicy sources.  Defaults to all ImagePolicies")
+	rootCmd.Flags().StringVar(&fluxAPIVersion, "flux-image-policy-version", "v1beta1", "The version of the image.toolkit.fluxcd.io API to use when monitoring for Flux ImagePolicy sources")
+	rootCmd.Flags().BoolVar(&watchImageCachePolicies, "watch-image-cache-policies", false, "Whether or not to watch ImageCachePolicies for images to pull.  Requires the CRD in manifests/crds")
+	rootCmd.Flags().BoolVar(&writePolicyStatus, "write-image-cache-policy-status", false, "Whether or not to report how many nodes have cached each image in the status of ImageCachePolicies.  Every daemon reports the images it cached on its own pod, and a single elected daemon writes the status")
+	rootCmd.Flags().DurationVar(&policyStatusInterval, "image-cache-policy-status-interval", time.Minute, "How often the status of ImageCachePolicies should be written")
+	rootCmd.Flags().StringVar(&daemonSelector, "daemon-selector", "app=image-cache-daemon", "The selector matching every daemon pod in --pod-namespace, whose cached images are counted in the status of ImageCachePolicies")
 	rootCmd.Flags().BoolVar(&watchConfigMaps, "watch-configmaps", true, "Whether or not to watch ConfigMaps for images to pull.  Must match the --config-map-selector")
+	rootCmd.Flags().BoolVar(&reportConfigMapErrors, "report-configmap-errors", true, "Whether or not to report ConfigMaps whose images cannot be parsed with an Event, recorded by a single daemon that is elected through a Lease")
+	rootCmd.Flags().BoolVar(&annotateConfigMapErrors, "annotate-configmap-errors", false, "Whether or not to write the error of ConfigMaps whose images cannot be parsed to their image-cache-daemon/last-error annotation.  Requires permission to update ConfigMaps, which manifests/configmap-last-error-rbac.yaml grants")
+	rootCmd.Flags().BoolVar(&watchSecrets, "watch-secrets", false, "Whether or not to watch Secrets for images to pull.  Must match the --secret-selector")
+	rootCmd.Flags().StringVar(&secretSelector, "secret-selector", "app.kubernetes.io/part-of=image-cache-daemon", "The selector to use when monitoring for Secret sources")
+	rootCmd.Flags().StringVar(&secretNamespace, "secret-namespace", os.Getenv("POD_NAMESPACE"), "The namespace to watch for Secret sources.  Set to an empty string to watch every namespace")
+	rootCmd.Flags().BoolVar(&watchHelmReleases, "watch-helm-releases", false, "Whether or not to watch Helm v3 releases for images to pull")
+	rootCmd.Flags().BoolVar(&watchWorkloads, "watch-workloads", false, "Whether or not to watch Deployments, StatefulSets, DaemonSets and ReplicaSets for images to pull.  Must match the --workload-selector")
+	rootCmd.Flags().StringVar(&workloadSelector, "workload-selector", "", "The selector to use when monitoring for workload sources.  Defaults to all workloads")
+	rootCmd.Flags().BoolVar(&watchJobs, "watch-jobs", false, "Whether or not to watch Jobs and CronJobs for images to pull.  Must match the --job-selector")
+	rootCmd.Flags().StringVar(&jobSelector, "job-selector", "", "The selector to use when monitoring for Job and CronJob sources.  Defaults to all Jobs and CronJobs")
+	rootCmd.Flags().BoolVar(&skipSuspendedJobs, "skip-suspended-jobs", true, "Whether or not to ignore suspended Jobs and CronJobs")
+	rootCmd.Flags().DurationVar(&cronLeadWindow, "cron-lead-window", 0, "How long before each run of a CronWorkflow or CronJob its images are pulled.  Outside of this window and their runs, their images are not kept.  Set to 0 to always keep them.")
+	rootCmd.Flags().DurationVar(&cronRunGrace, "cron-run-grace", time.Minute*10, "How long after a run of a CronWorkflow or CronJob is scheduled its images are kept when --cron-lead-window is set, in addition to while the run is active")
+	rootCmd.Flags().BoolVar(&watchPods, "watch-pods", false, "Whether or not to pull images that are already in use by running pods elsewhere in the cluster")
+	rootCmd.Flags().IntVar(&podMinCount, "pod-min-count", 2, "The number of running pods that must use an image before it is pulled.  Set to 0 to disable.")
+	rootCmd.Flags().IntVar(&podMinNamespaces, "pod-min-namespaces", 0, "The number of namespaces that must run an image before it is pulled.  Set to 0 to disable.")
+	rootCmd.Flags().BoolVar(&watchPullEvents, "watch-pull-events", false, "Whether or not to pull images that kubelet reports pulling for pods elsewhere in the cluster")
+	rootCmd.Flags().DurationVar(&pullEventMinDuration, "pull-event-min-duration", 0, "Only pull images whose pull took at least this long on another node.  Set to 0 to also pull images as soon as another node starts pulling them")
+	rootCmd.Flags().BoolVar(&watchAnnotations, "watch-annotations", false, "Whether or not to pull the images listed in the image-cache-daemon/images annotation of the --annotation-resource resources")
+	rootCmd.Flags().StringArrayVar(&annotationResources, "annotation-resource", []string{"apps/v1/deployments", "apps/v1/statefulsets", "apps/v1/daemonsets", "batch/v1/jobs", "batch/v1/cronjobs"}, "A resource of the form <group>/<version>/<resource> whose image-cache-daemon/images annotation should be read.  May be provided multiple times")
+	rootCmd.Flags().StringArrayVar(&customResourceRules, "custom-resource-rule", []string{}, "A rule of the form <group>/<version>/<resource>[?<selector>]: <jsonpath> describing where images are found in a resource.  May be provided multiple times")
+	rootCmd.Flags().StringSliceVar(&namespaces, "namespaces", []string{}, "A comma separated list of namespaces that sources of namespaced resources should watch.  Defaults to all namespaces")
+	rootCmd.Flags().StringVar(&namespaceSelector, "namespace-selector", "", "A label selector for the namespaces that sources of namespaced resources should watch.  Namespaces are added and removed as their labels change.  Defaults to all namespaces")
 	rootCmd.Flags().DurationVar(&resyncPeriod, "resync-period", time.Minute*15, "How often the daemon should re-pull images from all of the sources.  Set to 0 to disable.")
 
 	return rootCmd
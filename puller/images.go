@@ -0,0 +1,56 @@
+package puller
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// normalizeImage expands an image reference to the form that the kubelet reports in the status of
+// the node, following the same defaulting rules as docker, so that "alpine" and
+// "docker.io/library/alpine:latest" refer to the same image
+func normalizeImage(image string) string {
+	name, suffix := image, ":latest"
+
+	if i := strings.Index(image, "@"); i >= 0 {
+		name, suffix = image[:i], image[i:]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, suffix = image[:i], image[i:]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+
+	switch {
+	case len(parts) == 1:
+		name = "docker.io/library/" + name
+	case parts[0] == "index.docker.io":
+		name = "docker.io/" + parts[1]
+	case !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost":
+		name = "docker.io/" + name
+	}
+
+	if strings.HasPrefix(name, "docker.io/") && !strings.Contains(strings.TrimPrefix(name, "docker.io/"), "/") {
+		name = "docker.io/library/" + strings.TrimPrefix(name, "docker.io/")
+	}
+
+	return name + suffix
+}
+
+// nodeImages returns the normalized names of every image that the kubelet reports in the status of
+// node.  The kubelet only reports a limited number of images, so an image that is missing may still
+// be present.
+func nodeImages(node *corev1.Node) map[string]bool {
+	images := make(map[string]bool)
+
+	if node == nil {
+		return images
+	}
+
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			images[normalizeImage(name)] = true
+		}
+	}
+
+	return images
+}
@@ -0,0 +1,24 @@
+package puller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_normalizeImage(t *testing.T) {
+	for image, expected := range map[string]string{
+		"alpine":                                  "docker.io/library/alpine:latest",
+		"alpine:3.14":                             "docker.io/library/alpine:3.14",
+		"alpine@sha256:abc":                       "docker.io/library/alpine@sha256:abc",
+		"docker.io/alpine":                        "docker.io/library/alpine:latest",
+		"index.docker.io/library/alpine:3.14":     "docker.io/library/alpine:3.14",
+		"argoproj/argoexec:v3.2.11":               "docker.io/argoproj/argoexec:v3.2.11",
+		"quay.io/argoproj/argoexec":               "quay.io/argoproj/argoexec:latest",
+		"localhost/image:1":                       "localhost/image:1",
+		"localhost:5000/image":                    "localhost:5000/image:latest",
+		"registry.example.com:5000/team/image:v1": "registry.example.com:5000/team/image:v1",
+	} {
+		assert.Equal(t, expected, normalizeImage(image), image)
+	}
+}
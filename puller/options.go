@@ -0,0 +1,109 @@
+package puller
+
+import (
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// resolvedOptions combine the ImageOptions of every source that requested an image
+type resolvedOptions struct {
+	priority   int32
+	pullPolicy source.PullPolicy
+}
+
+// nodePlatform returns the operating system and architecture of node
+func nodePlatform(node *corev1.Node) (string, string) {
+	os, arch := node.Labels[corev1.LabelOSStable], node.Labels[corev1.LabelArchStable]
+
+	if os == "" {
+		os = node.Status.NodeInfo.OperatingSystem
+	}
+
+	if arch == "" {
+		arch = node.Status.NodeInfo.Architecture
+	}
+
+	return os, arch
+}
+
+// optionsApply returns whether an image requested with options should be pulled to node at now
+func optionsApply(options *source.ImageOptions, node *corev1.Node, now time.Time) bool {
+	if options.ExpiresAt != nil && !now.Before(*options.ExpiresAt) {
+		return false
+	}
+
+	if len(options.NodeSelector) == 0 && len(options.Platforms) == 0 {
+		return true
+	}
+
+	// Images that are restricted to some nodes are never pulled until this node has been observed
+	if node == nil {
+		return false
+	}
+
+	if !labels.SelectorFromSet(options.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if len(options.Platforms) == 0 {
+		return true
+	}
+
+	os, arch := nodePlatform(node)
+
+	for _, platform := range options.Platforms {
+		// The variant of a platform is not reported by nodes, so only the os and architecture are compared
+		if parts := strings.Split(platform, "/"); len(parts) >= 2 && parts[0] == os && parts[1] == arch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveOptions combines every element of options that applies to node, and returns false if none
+// of them do.  An image requested without any options is always pulled.  The highest priority wins,
+// and the image is pulled if it may be missing as long as any request asks for it to always be pulled.
+func resolveOptions(options []source.ImageOptions, node *corev1.Node, now time.Time) (*resolvedOptions, bool) {
+	if len(options) == 0 {
+		return &resolvedOptions{pullPolicy: source.PullAlways}, true
+	}
+
+	var resolved *resolvedOptions
+
+	for idx := range options {
+		if !optionsApply(&options[idx], node, now) {
+			continue
+		}
+
+		pullPolicy := options[idx].PullPolicy
+
+		if pullPolicy == "" {
+			pullPolicy = source.PullAlways
+		}
+
+		if resolved == nil {
+			resolved = &resolvedOptions{
+				priority:   options[idx].Priority,
+				pullPolicy: pullPolicy,
+			}
+
+			continue
+		}
+
+		if options[idx].Priority > resolved.priority {
+			resolved.priority = options[idx].Priority
+		}
+
+		if pullPolicy == source.PullAlways {
+			resolved.pullPolicy = source.PullAlways
+		}
+	}
+
+	return resolved, resolved != nil
+}
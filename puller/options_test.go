@@ -0,0 +1,131 @@
+package puller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func testNode(labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node",
+			Labels: labels,
+		},
+	}
+}
+
+func Test_resolveOptions(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	gpuNode := testNode(map[string]string{"gpu": "true", corev1.LabelOSStable: "linux", corev1.LabelArchStable: "amd64"})
+
+	unlabeledArmNode := testNode(nil)
+	unlabeledArmNode.Status.NodeInfo = corev1.NodeSystemInfo{OperatingSystem: "linux", Architecture: "arm64"}
+
+	for _, tc := range []struct {
+		name     string
+		options  []source.ImageOptions
+		node     *corev1.Node
+		expected *resolvedOptions
+	}{
+		{
+			name:     "no options",
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name:     "no options before the node is observed",
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name:     "matching node selector",
+			options:  []source.ImageOptions{{NodeSelector: map[string]string{"gpu": "true"}, Priority: 3}},
+			node:     gpuNode,
+			expected: &resolvedOptions{priority: 3, pullPolicy: source.PullAlways},
+		},
+		{
+			name:    "node selector that does not match",
+			options: []source.ImageOptions{{NodeSelector: map[string]string{"gpu": "false"}}},
+			node:    gpuNode,
+		},
+		{
+			name:    "node selector before the node is observed",
+			options: []source.ImageOptions{{NodeSelector: map[string]string{"gpu": "true"}}},
+		},
+		{
+			name:     "matching platform",
+			options:  []source.ImageOptions{{Platforms: []string{"linux/arm64", "linux/amd64"}}},
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name:     "platform variant is ignored",
+			options:  []source.ImageOptions{{Platforms: []string{"linux/arm64/v8"}}},
+			node:     unlabeledArmNode,
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name:    "platform that does not match",
+			options: []source.ImageOptions{{Platforms: []string{"windows/amd64"}}},
+			node:    gpuNode,
+		},
+		{
+			name:     "unexpired",
+			options:  []source.ImageOptions{{ExpiresAt: &future}},
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name:    "expired",
+			options: []source.ImageOptions{{ExpiresAt: &past}},
+			node:    gpuNode,
+		},
+		{
+			name: "highest applicable priority wins",
+			options: []source.ImageOptions{
+				{Priority: 1},
+				{Priority: 5},
+				{Priority: 10, ExpiresAt: &past},
+				{Priority: 20, NodeSelector: map[string]string{"gpu": "false"}},
+			},
+			node:     gpuNode,
+			expected: &resolvedOptions{priority: 5, pullPolicy: source.PullAlways},
+		},
+		{
+			name:     "if-not-present",
+			options:  []source.ImageOptions{{PullPolicy: source.PullIfNotPresent}},
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullIfNotPresent},
+		},
+		{
+			name:     "always wins over if-not-present",
+			options:  []source.ImageOptions{{PullPolicy: source.PullIfNotPresent}, {}},
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullAlways},
+		},
+		{
+			name: "always is ignored once expired",
+			options: []source.ImageOptions{
+				{PullPolicy: source.PullIfNotPresent},
+				{PullPolicy: source.PullAlways, ExpiresAt: &past},
+			},
+			node:     gpuNode,
+			expected: &resolvedOptions{pullPolicy: source.PullIfNotPresent},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, ok := resolveOptions(tc.options, tc.node, now)
+
+			assert.Equal(t, tc.expected != nil, ok)
+			assert.Equal(t, tc.expected, resolved)
+		})
+	}
+}
@@ -2,10 +2,21 @@ package puller
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/dcherman/image-cache-daemon/source"
 	"github.com/dcherman/image-cache-daemon/strategy"
@@ -14,52 +25,381 @@ import (
 type ImagePuller struct {
 	strategy      strategy.PullStrategy
 	kubeClient    kubernetes.Interface
-	imageSourceCh chan string
+	imageSourceCh chan *pullRequest
 
 	podNamespace string
 	podName      string
 
-	pendingImages map[string]bool
+	// nodeInformer watches the node that images are pulled to, whose labels are matched against the
+	// node selectors and platforms of the ImageOptions of each image
+	nodeInformer cache.SharedIndexInformer
+
+	maxConcurrentPulls int
+	queue              *pullQueue
+	pendingImages      map[string]bool
+
+	// desiredImages holds the sources that currently hold each image, along with the key of the last
+	// object that each of them requested the image for, and is only accessed by Run
+	desiredImages map[string]map[string]string
+
+	// pulledImages are the desired images that have been pulled successfully, and is only accessed
+	// by Run
+	pulledImages map[string]bool
+	// nodeCh is signalled whenever the node that images are pulled to changes
+	nodeCh chan struct{}
+
+	// cachedImages are the desired images that have been pulled or that the status of the node lists,
+	// which are reported in the source.CachedImagesAnnotation of the daemon pod whenever reportCh is
+	// signalled if reportCached is set.  It is guarded by cachedLock.
+	cachedImages map[string]bool
+	reportCached bool
+	cachedLock   sync.Mutex
+	reportCh     chan struct{}
 }
 
-func NewImagePuller(strategy strategy.PullStrategy, kubeClient kubernetes.Interface, podNamespace, podName string) *ImagePuller {
+type ImagePullerOpts struct {
+	Strategy   strategy.PullStrategy
+	KubeClient kubernetes.Interface
+
+	NodeName     string
+	PodNamespace string
+	PodName      string
+
+	// MaxConcurrentPulls limits the number of images pulled at once, queueing the rest in order of
+	// priority.  Zero pulls every image as soon as it is received.
+	MaxConcurrentPulls int
+
+	// ReportCachedImages reports the images that have been pulled in the source.CachedImagesAnnotation
+	// of the daemon pod, which is only read when the status of ImageCachePolicies is written
+	ReportCachedImages bool
+}
+
+func NewImagePuller(opts *ImagePullerOpts) *ImagePuller {
+	fac := informers.NewSharedInformerFactoryWithOptions(opts.KubeClient, 0, informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+		lo.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.NodeName).String()
+	}))
+
 	ip := ImagePuller{
-		kubeClient:    kubeClient,
-		strategy:      strategy,
-		imageSourceCh: make(chan string),
-		pendingImages: map[string]bool{},
-		podNamespace:  podNamespace,
-		podName:       podName,
+		kubeClient:         opts.KubeClient,
+		strategy:           opts.Strategy,
+		imageSourceCh:      make(chan *pullRequest),
+		nodeInformer:       fac.Core().V1().Nodes().Informer(),
+		maxConcurrentPulls: opts.MaxConcurrentPulls,
+		queue:              newPullQueue(),
+		pendingImages:      map[string]bool{},
+		desiredImages:      map[string]map[string]string{},
+		pulledImages:       map[string]bool{},
+		nodeCh:             make(chan struct{}, 1),
+		cachedImages:       map[string]bool{},
+		reportCh:           make(chan struct{}, 1),
+		reportCached:       opts.ReportCachedImages,
+		podNamespace:       opts.PodNamespace,
+		podName:            opts.PodName,
 	}
 
 	return &ip
 }
 
 func (ip *ImagePuller) AddSource(ctx context.Context, src source.ImageSource) {
-	imageCh := src.ImageCh()
+	events := src.Events()
+	optionsSource, hasOptions := src.(source.ImageOptionsSource)
 
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case image, ok := <-imageCh:
+			case event, ok := <-events:
 				if !ok {
 					return
 				}
 
 				logrus.WithFields(logrus.Fields{
-					"image":  image,
-					"source": src.Name(),
-				}).Info("image received")
+					"image":  event.Image,
+					"source": event.Source,
+					"object": event.Object,
+					"event":  event.Type,
+				}).Info("image event received")
+
+				var options []source.ImageOptions
+
+				if hasOptions && event.Type != source.ImageRemoved {
+					options = optionsSource.ImageOptions(event.Image)
+				}
+
+				req := &pullRequest{
+					image:      event.Image,
+					eventType:  event.Type,
+					sourceName: event.Source,
+					object:     event.Object,
+					options:    map[string][]source.ImageOptions{event.Source: options},
+				}
 
-				ip.imageSourceCh <- image
+				select {
+				case <-ctx.Done():
+					return
+				case ip.imageSourceCh <- req:
+				}
 			}
 		}
 	}()
 }
 
+// handleEvent updates the desired images with req, queueing its image to be pulled unless it was
+// removed.  An image that no source holds any longer is dropped from the queue, although a pull that
+// is already pending runs to completion.
+func (ip *ImagePuller) handleEvent(req *pullRequest) {
+	if req.eventType == source.ImageRemoved {
+		delete(ip.desiredImages[req.image], req.sourceName)
+
+		if len(ip.desiredImages[req.image]) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"image":  req.image,
+				"source": req.sourceName,
+				"object": req.object,
+			}).Info("image is no longer used by any source")
+			delete(ip.desiredImages, req.image)
+			delete(ip.pulledImages, req.image)
+			ip.queue.remove(req.image)
+		} else {
+			ip.queue.removeSource(req.image, req.sourceName)
+		}
+
+		return
+	}
+
+	if _, ok := ip.desiredImages[req.image]; !ok {
+		ip.desiredImages[req.image] = make(map[string]string)
+	}
+
+	// Sources only emit an image once while they hold it, so a Resync without an object keeps the
+	// object that the image was added for
+	if _, ok := ip.desiredImages[req.image][req.sourceName]; !ok || req.object != "" {
+		ip.desiredImages[req.image][req.sourceName] = req.object
+	}
+	ip.enqueue(req)
+}
+
+// wantedBy returns every source that holds image, in the form <source>:<object> when the object that
+// the source requested the image for is known
+func (ip *ImagePuller) wantedBy(image string) []string {
+	var wanted []string
+
+	for sourceName, object := range ip.desiredImages[image] {
+		if object == "" {
+			wanted = append(wanted, sourceName)
+			continue
+		}
+
+		wanted = append(wanted, sourceName+":"+object)
+	}
+
+	sort.Strings(wanted)
+
+	return wanted
+}
+
+// recordCachedImage records that image was pulled successfully
+func (ip *ImagePuller) recordCachedImage(image string) {
+	if _, ok := ip.desiredImages[image]; ok {
+		ip.pulledImages[image] = true
+	}
+
+	ip.updateCachedImages()
+}
+
+// updateCachedImages recomputes the images reported by the daemon pod, which are the desired images
+// that were pulled or that the status of the node lists, and signals reportCh if they changed
+func (ip *ImagePuller) updateCachedImages() {
+	if !ip.reportCached {
+		return
+	}
+
+	onNode := nodeImages(ip.node())
+	cached := make(map[string]bool)
+
+	for image := range ip.desiredImages {
+		if ip.pulledImages[image] || onNode[normalizeImage(image)] {
+			cached[image] = true
+		}
+	}
+
+	ip.cachedLock.Lock()
+	defer ip.cachedLock.Unlock()
+
+	if reflect.DeepEqual(cached, ip.cachedImages) {
+		return
+	}
+
+	ip.cachedImages = cached
+
+	select {
+	case ip.reportCh <- struct{}{}:
+	default:
+	}
+}
+
+func (ip *ImagePuller) reportCachedImages(ctx context.Context) error {
+	ip.cachedLock.Lock()
+
+	var images []string
+
+	for image := range ip.cachedImages {
+		images = append(images, image)
+	}
+
+	ip.cachedLock.Unlock()
+
+	sort.Strings(images)
+
+	value, err := json.Marshal(images)
+
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				source.CachedImagesAnnotation: string(value),
+			},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ip.kubeClient.CoreV1().Pods(ip.podNamespace).Patch(ctx, ip.podName, types.MergePatchType, patch, v1.PatchOptions{})
+
+	return err
+}
+
+// runReporter patches the daemon pod with the cached images whenever they change, so that the
+// ImageCachePolicyStatusWriter can count the nodes that cached each image.  Pulls are never blocked
+// on the API server, and changes made while a patch is in flight are coalesced into the next one.
+func (ip *ImagePuller) runReporter(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ip.reportCh:
+			if err := ip.reportCachedImages(ctx); err != nil {
+				logrus.Errorf("failed to report cached images: %v", err)
+			}
+		}
+	}
+}
+
+// node returns the node that images are pulled to, or nil if it has not been observed
+func (ip *ImagePuller) node() *corev1.Node {
+	for _, obj := range ip.nodeInformer.GetIndexer().List() {
+		if node, ok := obj.(*corev1.Node); ok {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// isCached returns whether image was pulled or is listed in the status of the node
+func (ip *ImagePuller) isCached(image string) bool {
+	return ip.pulledImages[image] || nodeImages(ip.node())[normalizeImage(image)]
+}
+
+// nodeEventHandler signals nodeCh whenever the node that images are pulled to changes
+func (ip *ImagePuller) nodeEventHandler() cache.ResourceEventHandler {
+	signal := func() {
+		select {
+		case ip.nodeCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			signal()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			signal()
+		},
+	}
+}
+
+// enqueue queues req with the highest priority of the options that currently apply to this node
+func (ip *ImagePuller) enqueue(req *pullRequest) {
+	if options, ok := resolveOptions(req.imageOptions(), ip.node(), time.Now()); ok {
+		req.priority = options.priority
+	}
+
+	ip.queue.push(req)
+}
+
+// pullQueued starts pulling queued images until MaxConcurrentPulls are pending
+func (ip *ImagePuller) pullQueued(ctx context.Context) {
+	for ip.queue.len() > 0 && (ip.maxConcurrentPulls <= 0 || len(ip.pendingImages) < ip.maxConcurrentPulls) {
+		req := ip.queue.pop()
+		l := logrus.WithFields(logrus.Fields{
+			"image":    req.image,
+			"wantedBy": ip.wantedBy(req.image),
+		})
+
+		if _, ok := ip.pendingImages[req.image]; ok {
+			l.Info("image pull is already pending, skipping")
+
+			// TODO: Should we inspect what images already exist on a given node in order to avoid re-pulling
+			// images?  We would need to inspect the image metadata in order to determine whether or not
+			// the digest for a given tag has changed (if we were given a tag and not a digest).  If the tag
+			// did not change, then running a pod anyway will have little effect and already does that check for us.
+			// The biggest disadvantage of always running a pod is that we're temporarily consuming a spot on the node
+			// for running a pod (nodes have a max number of pods that can run concurrently), and in the case of the aws-vpc
+			// CNI plugin and maybe others, we're consuming an IP address for a short period of time and subsequently making
+			// it go into a cooldown period, if that applies to the CNI.
+
+			// For now, we'll always pull for simplicity unless an image asks for the if-not-present pull policy.
+			continue
+		}
+
+		// Options are resolved again since the node or the expiry of the image may have changed while it was queued
+		options, ok := resolveOptions(req.imageOptions(), ip.node(), time.Now())
+
+		if !ok {
+			l.Info("image is expired or not intended for this node, skipping")
+			continue
+		}
+
+		pullPolicy := corev1.PullAlways
+
+		if options.pullPolicy == source.PullIfNotPresent {
+			if ip.isCached(req.image) {
+				l.Info("image was already pulled, skipping")
+				continue
+			}
+
+			pullPolicy = corev1.PullIfNotPresent
+		}
+
+		ip.pendingImages[req.image] = true
+
+		if err := ip.strategy.PullImage(ctx, req.image, pullPolicy); err != nil {
+			delete(ip.pendingImages, req.image)
+			log.Print(err)
+		}
+	}
+}
+
 func (ip *ImagePuller) Run(ctx context.Context) {
+	if ip.reportCached {
+		go ip.runReporter(ctx)
+	}
+
+	ip.nodeInformer.AddEventHandler(ip.nodeEventHandler())
+	go ip.nodeInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), ip.nodeInformer.HasSynced) {
+		return
+	}
+
 	doneCh := ctx.Done()
 	successCh := ip.strategy.ImagePullSuccessCh()
 	errorCh := ip.strategy.ImagePullErrorCh()
@@ -68,31 +408,15 @@ func (ip *ImagePuller) Run(ctx context.Context) {
 		select {
 		case <-doneCh:
 			return
-		case image := <-ip.imageSourceCh:
-			if _, ok := ip.pendingImages[image]; !ok {
-				ip.pendingImages[image] = true
-
-				if err := ip.strategy.PullImage(ctx, image); err != nil {
-					delete(ip.pendingImages, image)
-					log.Print(err)
-				}
-			} else {
-				logrus.WithField("image", image).Info("image pull is already pending, skipping")
-
-				// TODO: Should we inspect what images already exist on a given node in order to avoid re-pulling
-				// images?  We would need to inspect the image metadata in order to determine whether or not
-				// the digest for a given tag has changed (if we were given a tag and not a digest).  If the tag
-				// did not change, then running a pod anyway will have little effect and already does that check for us.
-				// The biggest disadvantage of always running a pod is that we're temporarily consuming a spot on the node
-				// for running a pod (nodes have a max number of pods that can run concurrently), and in the case of the aws-vpc
-				// CNI plugin and maybe others, we're consuming an IP address for a short period of time and subsequently making
-				// it go into a cooldown period, if that applies to the CNI.
-
-				// For now, we'll always pull for simplicity, but this is potentially an area of improvement.
-			}
+		case req := <-ip.imageSourceCh:
+			ip.handleEvent(req)
+			ip.updateCachedImages()
+		case <-ip.nodeCh:
+			ip.updateCachedImages()
 		case successfulImage := <-successCh:
 			logrus.WithField("image", successfulImage).Info("image successfully pulled")
 			delete(ip.pendingImages, successfulImage)
+			ip.recordCachedImage(successfulImage)
 
 			// The image locality scheduling plugin (enabled by default) already prefers nodes
 			// that already have the image being referenced.  We might not need to use this hack
@@ -107,5 +431,7 @@ func (ip *ImagePuller) Run(ctx context.Context) {
 			logrus.WithField("image", erroredImage).Info("failed to pull image")
 			delete(ip.pendingImages, erroredImage)
 		}
+
+		ip.pullQueued(ctx)
 	}
 }
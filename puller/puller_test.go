@@ -0,0 +1,253 @@
+package puller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// fakePull is an image pulled by fakeStrategy along with its pull policy
+type fakePull struct {
+	image      string
+	pullPolicy corev1.PullPolicy
+}
+
+// fakeStrategy records every pull, which is left pending until the test completes it
+type fakeStrategy struct {
+	pulls []fakePull
+}
+
+func (s *fakeStrategy) PullImage(ctx context.Context, image string, pullPolicy corev1.PullPolicy) error {
+	s.pulls = append(s.pulls, fakePull{image: image, pullPolicy: pullPolicy})
+	return nil
+}
+
+func (s *fakeStrategy) ImagePullSuccessCh() <-chan string {
+	return nil
+}
+
+func (s *fakeStrategy) ImagePullErrorCh() <-chan string {
+	return nil
+}
+
+// newTestPuller creates a puller for a node with labels and images whose node informer has synced
+func newTestPuller(t *testing.T, maxConcurrentPulls int, labels map[string]string, images ...corev1.ContainerImage) (*ImagePuller, *fakeStrategy) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	strategy := &fakeStrategy{}
+
+	node := testNode(labels)
+	node.Status.Images = images
+
+	ip := NewImagePuller(&ImagePullerOpts{
+		Strategy:           strategy,
+		KubeClient:         fake.NewSimpleClientset(node),
+		NodeName:           "node",
+		MaxConcurrentPulls: maxConcurrentPulls,
+	})
+
+	go ip.nodeInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), ip.nodeInformer.HasSynced) {
+		t.Fatal("node informer never synced")
+	}
+
+	return ip, strategy
+}
+
+// pulledImages returns the image of every pull
+func pulledImages(strategy *fakeStrategy) []string {
+	var images []string
+
+	for _, pull := range strategy.pulls {
+		images = append(images, pull.image)
+	}
+
+	return images
+}
+
+func Test_ImagePuller_MaxConcurrentPulls(t *testing.T) {
+	ip, strategy := newTestPuller(t, 2, nil)
+	ctx := context.Background()
+
+	ip.handleEvent(testRequest("a", "ConfigMap", 0))
+	ip.handleEvent(testRequest("b", "ConfigMap", 0, source.ImageOptions{Priority: 5}))
+	ip.handleEvent(testRequest("c", "ConfigMap", 0, source.ImageOptions{Priority: 10}))
+	ip.pullQueued(ctx)
+
+	// Only MaxConcurrentPulls images are pulled at once, highest priority first
+	assert.Equal(t, []string{"c", "b"}, pulledImages(strategy))
+	assert.Equal(t, 1, ip.queue.len())
+
+	ip.pullQueued(ctx)
+	assert.Equal(t, []string{"c", "b"}, pulledImages(strategy))
+
+	// Completing a pull starts the next one
+	delete(ip.pendingImages, "c")
+	ip.pullQueued(ctx)
+
+	assert.Equal(t, []string{"c", "b", "a"}, pulledImages(strategy))
+	assert.Equal(t, 0, ip.queue.len())
+}
+
+func Test_ImagePuller_Unlimited(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, nil)
+
+	for _, image := range []string{"a", "b", "c"} {
+		ip.handleEvent(testRequest(image, "ConfigMap", 0))
+	}
+
+	ip.pullQueued(context.Background())
+
+	assert.Equal(t, []string{"a", "b", "c"}, pulledImages(strategy))
+}
+
+func Test_ImagePuller_PullPolicy(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, nil)
+
+	ifNotPresent := source.ImageOptions{PullPolicy: source.PullIfNotPresent}
+
+	ip.handleEvent(testRequest("cached-if-not-present", "ConfigMap", 0, ifNotPresent))
+	ip.handleEvent(testRequest("cached-always", "ConfigMap", 0))
+	ip.handleEvent(testRequest("missing-if-not-present", "ConfigMap", 0, ifNotPresent))
+
+	ip.recordCachedImage("cached-if-not-present")
+	ip.recordCachedImage("cached-always")
+
+	ip.pullQueued(context.Background())
+
+	// A cached image that may be missing is never pulled again
+	assert.Equal(t, []fakePull{
+		{image: "cached-always", pullPolicy: corev1.PullAlways},
+		{image: "missing-if-not-present", pullPolicy: corev1.PullIfNotPresent},
+	}, strategy.pulls)
+}
+
+func Test_ImagePuller_PullPolicyOfNodeImages(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, nil, corev1.ContainerImage{Names: []string{"docker.io/library/alpine:3.14"}})
+
+	ifNotPresent := source.ImageOptions{PullPolicy: source.PullIfNotPresent}
+
+	// An image that the status of the node lists is cached, even if this daemon never pulled it
+	ip.handleEvent(testRequest("alpine:3.14", "ConfigMap", 0, ifNotPresent))
+	ip.handleEvent(testRequest("alpine:3.15", "ConfigMap", 0, ifNotPresent))
+	ip.pullQueued(context.Background())
+
+	assert.Equal(t, []string{"alpine:3.15"}, pulledImages(strategy))
+}
+
+func Test_ImagePuller_CachedImages(t *testing.T) {
+	ip, _ := newTestPuller(t, 0, nil, corev1.ContainerImage{Names: []string{"docker.io/library/alpine@sha256:abc", "docker.io/library/alpine:3.14"}})
+	ip.reportCached = true
+
+	removed := func(image string, sourceName string) *pullRequest {
+		return &pullRequest{image: image, eventType: source.ImageRemoved, sourceName: sourceName}
+	}
+
+	reported := func() bool {
+		select {
+		case <-ip.reportCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	ip.handleEvent(testRequest("alpine:3.14", "ConfigMap", 0))
+	ip.handleEvent(testRequest("debian", "ConfigMap", 0))
+	ip.handleEvent(testRequest("nginx", "ConfigMap", 0))
+	ip.updateCachedImages()
+
+	assert.Equal(t, map[string]bool{"alpine:3.14": true}, ip.cachedImages)
+	assert.True(t, reported())
+
+	ip.recordCachedImage("debian")
+	assert.Equal(t, map[string]bool{"alpine:3.14": true, "debian": true}, ip.cachedImages)
+	assert.True(t, reported())
+
+	// An image that no source holds any longer is no longer reported
+	ip.handleEvent(removed("debian", "ConfigMap"))
+	ip.updateCachedImages()
+
+	assert.Equal(t, map[string]bool{"alpine:3.14": true}, ip.cachedImages)
+	assert.True(t, reported())
+
+	// Nor is it reported again once it is requested again, until it is pulled
+	ip.handleEvent(testRequest("debian", "ConfigMap", 0))
+	ip.updateCachedImages()
+
+	assert.Equal(t, map[string]bool{"alpine:3.14": true}, ip.cachedImages)
+	assert.False(t, reported())
+}
+
+func Test_ImagePuller_NodeSelector(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, map[string]string{"gpu": "true"})
+
+	ip.handleEvent(testRequest("cuda", "ConfigMap", 0, source.ImageOptions{NodeSelector: map[string]string{"gpu": "true"}}))
+	ip.handleEvent(testRequest("arm", "ConfigMap", 0, source.ImageOptions{NodeSelector: map[string]string{"kubernetes.io/arch": "arm64"}}))
+	ip.pullQueued(context.Background())
+
+	assert.Equal(t, []string{"cuda"}, pulledImages(strategy))
+}
+
+func Test_ImagePuller_NodeSelectorOfEverySource(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, map[string]string{"gpu": "true"})
+
+	// Another source that selects different nodes does not hide the node selector of the first
+	ip.handleEvent(testRequest("cuda", "ConfigMap", 0, source.ImageOptions{NodeSelector: map[string]string{"gpu": "true"}}))
+	ip.handleEvent(testRequest("cuda", "ImageCachePolicy", 0, source.ImageOptions{NodeSelector: map[string]string{"gpu": "false"}}))
+	ip.pullQueued(context.Background())
+
+	assert.Equal(t, []string{"cuda"}, pulledImages(strategy))
+}
+
+func Test_ImagePuller_Removed(t *testing.T) {
+	ip, strategy := newTestPuller(t, 0, nil)
+
+	removed := func(image string, sourceName string) *pullRequest {
+		return &pullRequest{image: image, eventType: source.ImageRemoved, sourceName: sourceName}
+	}
+
+	ip.handleEvent(testRequest("a", "ConfigMap", 0))
+	ip.handleEvent(testRequest("b", "ConfigMap", 0))
+	ip.handleEvent(testRequest("b", "Pod", 0))
+
+	// An image is only dropped from the queue once no source holds it
+	ip.handleEvent(removed("a", "ConfigMap"))
+	ip.handleEvent(removed("b", "ConfigMap"))
+
+	assert.Equal(t, map[string]map[string]string{"b": {"Pod": ""}}, ip.desiredImages)
+
+	ip.pullQueued(context.Background())
+
+	assert.Equal(t, []string{"b"}, pulledImages(strategy))
+}
+
+func Test_ImagePuller_WantedBy(t *testing.T) {
+	ip, _ := newTestPuller(t, 0, nil)
+
+	withObject := func(req *pullRequest, eventType source.ImageEventType, object string) *pullRequest {
+		req.eventType = eventType
+		req.object = object
+		return req
+	}
+
+	ip.handleEvent(withObject(testRequest("alpine", "ConfigMap", 0), source.ImageAdded, "default/images"))
+	ip.handleEvent(withObject(testRequest("alpine", "Static", 0), source.ImageAdded, ""))
+	ip.handleEvent(withObject(testRequest("alpine", "Pod", 0), source.ImageAdded, "default/web"))
+
+	// A resync that is not caused by an object keeps the object that the image was added for
+	ip.handleEvent(withObject(testRequest("alpine", "ConfigMap", 0), source.ImageResync, ""))
+	ip.handleEvent(withObject(testRequest("alpine", "Pod", 0), source.ImageResync, "default/api"))
+
+	assert.Equal(t, []string{"ConfigMap:default/images", "Pod:default/api", "Static"}, ip.wantedBy("alpine"))
+	assert.Empty(t, ip.wantedBy("debian"))
+}
@@ -0,0 +1,139 @@
+package puller
+
+import (
+	"container/heap"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// pullRequest is an event received from a source along with the options its image was requested with
+type pullRequest struct {
+	image      string
+	eventType  source.ImageEventType
+	sourceName string
+	// object is the key of the object that the source requested the image for, if any
+	object string
+	// options holds the ImageOptions that each source requested the image with, by the name of the source
+	options map[string][]source.ImageOptions
+
+	priority int32
+	seq      uint64
+}
+
+// imageOptions returns the options of every source that requested the image.  A source that attached
+// no options requests the image on every node, which is what the zero value of ImageOptions does.
+func (req *pullRequest) imageOptions() []source.ImageOptions {
+	var options []source.ImageOptions
+
+	for _, sourceOptions := range req.options {
+		if len(sourceOptions) == 0 {
+			options = append(options, source.ImageOptions{})
+			continue
+		}
+
+		options = append(options, sourceOptions...)
+	}
+
+	return options
+}
+
+// pullQueue orders requests by priority, and then in the order that they were received
+type pullQueue struct {
+	requests []*pullRequest
+	byImage  map[string]*pullRequest
+	seq      uint64
+}
+
+func newPullQueue() *pullQueue {
+	return &pullQueue{
+		byImage: make(map[string]*pullRequest),
+	}
+}
+
+// push queues req, or merges it into the request for the same image if one is already queued.  The
+// options of a source replace only the options that the same source queued earlier, so that an image
+// requested by several sources is pulled wherever any of them asks for it.
+func (q *pullQueue) push(req *pullRequest) {
+	if queued, ok := q.byImage[req.image]; ok {
+		for sourceName, options := range req.options {
+			queued.options[sourceName] = options
+		}
+
+		if req.priority > queued.priority {
+			queued.priority = req.priority
+			heap.Init((*pullHeap)(q))
+		}
+
+		return
+	}
+
+	q.seq++
+	req.seq = q.seq
+	q.byImage[req.image] = req
+
+	heap.Push((*pullHeap)(q), req)
+}
+
+func (q *pullQueue) pop() *pullRequest {
+	req := heap.Pop((*pullHeap)(q)).(*pullRequest)
+	delete(q.byImage, req.image)
+
+	return req
+}
+
+// remove drops the request for image if one is queued
+func (q *pullQueue) remove(image string) {
+	if _, ok := q.byImage[image]; !ok {
+		return
+	}
+
+	for idx, req := range q.requests {
+		if req.image == image {
+			heap.Remove((*pullHeap)(q), idx)
+			break
+		}
+	}
+
+	delete(q.byImage, image)
+}
+
+// removeSource drops the options that sourceName requested image with if a request for image is queued
+func (q *pullQueue) removeSource(image string, sourceName string) {
+	if queued, ok := q.byImage[image]; ok {
+		delete(queued.options, sourceName)
+	}
+}
+
+func (q *pullQueue) len() int {
+	return len(q.requests)
+}
+
+// pullHeap implements heap.Interface for a pullQueue
+type pullHeap pullQueue
+
+func (h *pullHeap) Len() int {
+	return len(h.requests)
+}
+
+func (h *pullHeap) Less(i, j int) bool {
+	if h.requests[i].priority != h.requests[j].priority {
+		return h.requests[i].priority > h.requests[j].priority
+	}
+
+	return h.requests[i].seq < h.requests[j].seq
+}
+
+func (h *pullHeap) Swap(i, j int) {
+	h.requests[i], h.requests[j] = h.requests[j], h.requests[i]
+}
+
+func (h *pullHeap) Push(x interface{}) {
+	h.requests = append(h.requests, x.(*pullRequest))
+}
+
+func (h *pullHeap) Pop() interface{} {
+	last := h.requests[len(h.requests)-1]
+	h.requests = h.requests[:len(h.requests)-1]
+
+	return last
+}
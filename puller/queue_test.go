@@ -0,0 +1,137 @@
+package puller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func testRequest(image string, sourceName string, priority int32, options ...source.ImageOptions) *pullRequest {
+	return &pullRequest{
+		image:      image,
+		eventType:  source.ImageAdded,
+		sourceName: sourceName,
+		options:    map[string][]source.ImageOptions{sourceName: options},
+		priority:   priority,
+	}
+}
+
+// popAll returns the images of every queued request in the order that they are pulled
+func popAll(q *pullQueue) []string {
+	var images []string
+
+	for q.len() > 0 {
+		images = append(images, q.pop().image)
+	}
+
+	return images
+}
+
+func Test_pullQueue(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		requests []*pullRequest
+		removed  []string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			expected: nil,
+		},
+		{
+			name: "in order of priority, and then in the order received",
+			requests: []*pullRequest{
+				testRequest("a", "ConfigMap", 0),
+				testRequest("b", "ConfigMap", 10),
+				testRequest("c", "ConfigMap", 0),
+				testRequest("d", "ConfigMap", 5),
+				testRequest("e", "ConfigMap", 10),
+			},
+			expected: []string{"b", "e", "d", "a", "c"},
+		},
+		{
+			name: "a queued image keeps its place",
+			requests: []*pullRequest{
+				testRequest("a", "ConfigMap", 0),
+				testRequest("b", "ConfigMap", 0),
+				testRequest("a", "Pod", 0),
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "a queued image is moved ahead by a higher priority",
+			requests: []*pullRequest{
+				testRequest("a", "ConfigMap", 0),
+				testRequest("b", "ConfigMap", 0),
+				testRequest("b", "ImageCachePolicy", 5),
+			},
+			expected: []string{"b", "a"},
+		},
+		{
+			name: "removed",
+			requests: []*pullRequest{
+				testRequest("a", "ConfigMap", 0),
+				testRequest("b", "ConfigMap", 10),
+				testRequest("c", "ConfigMap", 5),
+				testRequest("d", "ConfigMap", 1),
+			},
+			removed:  []string{"c", "unknown"},
+			expected: []string{"b", "d", "a"},
+		},
+		{
+			name: "removed every image",
+			requests: []*pullRequest{
+				testRequest("a", "ConfigMap", 0),
+				testRequest("b", "ConfigMap", 0),
+			},
+			removed:  []string{"b", "a"},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newPullQueue()
+
+			for _, req := range tc.requests {
+				q.push(req)
+			}
+
+			for _, image := range tc.removed {
+				q.remove(image)
+			}
+
+			assert.Equal(t, tc.expected, popAll(q))
+			assert.Empty(t, q.byImage)
+		})
+	}
+}
+
+func Test_pullQueue_MergeOptions(t *testing.T) {
+	gpu := source.ImageOptions{NodeSelector: map[string]string{"gpu": "true"}}
+	arm := source.ImageOptions{NodeSelector: map[string]string{"kubernetes.io/arch": "arm64"}}
+	amd := source.ImageOptions{NodeSelector: map[string]string{"kubernetes.io/arch": "amd64"}}
+
+	q := newPullQueue()
+
+	q.push(testRequest("cuda", "ConfigMap", 0, gpu))
+	q.push(testRequest("cuda", "ImageCachePolicy", 0, arm))
+
+	// The node selectors of every source are kept
+	assert.ElementsMatch(t, []source.ImageOptions{gpu, arm}, q.byImage["cuda"].imageOptions())
+
+	// The newest options of a source replace its own
+	q.push(testRequest("cuda", "ImageCachePolicy", 0, amd))
+	assert.ElementsMatch(t, []source.ImageOptions{gpu, amd}, q.byImage["cuda"].imageOptions())
+
+	// A source without options requests the image on every node
+	q.push(testRequest("cuda", "Pod", 0))
+	assert.ElementsMatch(t, []source.ImageOptions{gpu, amd, {}}, q.byImage["cuda"].imageOptions())
+
+	q.removeSource("cuda", "Pod")
+	q.removeSource("cuda", "ConfigMap")
+	q.removeSource("unknown", "ConfigMap")
+	assert.Equal(t, []source.ImageOptions{amd}, q.byImage["cuda"].imageOptions())
+
+	assert.Equal(t, []string{"cuda"}, popAll(q))
+}
@@ -0,0 +1,69 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const imagesAnnotation = "image-cache-daemon/images"
+
+// getImagesFromAnnotation reads the images listed in the image-cache-daemon/images annotation, which
+// is a list of image names without the options accepted by the images key of a ConfigMap.
+func getImagesFromAnnotation(obj interface{}) (map[string]bool, error) {
+	accessor, err := meta.Accessor(obj)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get metadata of object: %v", err)
+	}
+
+	imagesStr, ok := accessor.GetAnnotations()[imagesAnnotation]
+
+	if !ok {
+		return make(map[string]bool), nil
+	}
+
+	imageMap, err := parseImageList(imagesStr)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal annotation %s on %s/%s: %v", imagesAnnotation, accessor.GetNamespace(), accessor.GetName(), err)
+	}
+
+	return imageMap, nil
+}
+
+// NewAnnotationSource creates a source that emits the images listed in the image-cache-daemon/images
+// annotation of any object of the given resources.  Only object metadata is watched.
+func NewAnnotationSource(client metadata.Interface, resyncPeriod time.Duration, resources []schema.GroupVersionResource) ImageSource {
+	var unique []schema.GroupVersionResource
+
+	seen := make(map[schema.GroupVersionResource]bool)
+
+	for _, resource := range resources {
+		if !seen[resource] {
+			seen[resource] = true
+			unique = append(unique, resource)
+		}
+	}
+
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "Annotation",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := metadatainformer.NewFilteredSharedInformerFactory(client, resyncPeriod, namespace, nil)
+
+			var informers []cache.SharedIndexInformer
+
+			for _, resource := range unique {
+				informers = append(informers, fac.ForResource(resource).Informer())
+			}
+
+			return newImageInformers(getImagesFromAnnotation, informers...)
+		},
+		resyncPeriod: resyncPeriod,
+	})
+}
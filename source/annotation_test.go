@@ -0,0 +1,173 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+var (
+	deploymentResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	serviceResource    = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+)
+
+func annotatedObject(apiVersion, kind, name, images string) *metav1.PartialObjectMetadata {
+	obj := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+	}
+
+	if images != "" {
+		obj.Annotations = map[string]string{
+			"image-cache-daemon/images": images,
+		}
+	}
+
+	return obj
+}
+
+func newFakeMetadataClient(objects ...runtime.Object) *metadatafake.FakeMetadataClient {
+	scheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+
+	return metadatafake.NewSimpleMetadataClient(scheme, objects...)
+}
+
+func Test_AnnotationSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeMetadataClient(
+		annotatedObject("apps/v1", "Deployment", "web", `["nginx", "alpine"]`),
+		annotatedObject("apps/v1", "Deployment", "worker", ""),
+		annotatedObject("v1", "Service", "api", `
+- debian
+- alpine
+`),
+	)
+
+	src := source.NewAnnotationSource(fakeClient, time.Minute*15, []schema.GroupVersionResource{deploymentResource, serviceResource})
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx", "alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"nginx", "alpine", "debian"})
+}
+
+func Test_AnnotationSource_UnwatchedResource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeMetadataClient(
+		annotatedObject("apps/v1", "Deployment", "web", `["nginx"]`),
+		annotatedObject("v1", "Service", "api", `["debian"]`),
+	)
+
+	src := source.NewAnnotationSource(fakeClient, time.Minute*15, []schema.GroupVersionResource{deploymentResource})
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx"})
+}
+
+func Test_AnnotationSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeMetadataClient(annotatedObject("apps/v1", "Deployment", "web", `["nginx", "alpine"]`))
+
+	src := source.NewAnnotationSource(fakeClient, time.Minute*15, []schema.GroupVersionResource{deploymentResource})
+
+	go src.Run(ctx)
+
+	annotationSource := src.(*source.InformerSource)
+
+	for !annotationSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_, err := fakeClient.Resource(deploymentResource).Namespace("default").(metadatafake.MetadataClient).UpdateFake(annotatedObject("apps/v1", "Deployment", "web", `["nginx", "debian"]`), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx", "alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"nginx", "debian"})
+}
+
+func Test_AnnotationSource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeMetadataClient(
+		annotatedObject("apps/v1", "Deployment", "web", `["nginx", "alpine"]`),
+		annotatedObject("apps/v1", "Deployment", "worker", `["debian"]`),
+	)
+
+	src := source.NewAnnotationSource(fakeClient, time.Minute*15, []schema.GroupVersionResource{deploymentResource})
+
+	go src.Run(ctx)
+
+	annotationSource := src.(*source.InformerSource)
+
+	for !annotationSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err := fakeClient.Resource(deploymentResource).Namespace("default").Delete(ctx, "worker", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx", "alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"nginx", "alpine"})
+}
+
+func Test_AnnotationSource_BadInput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeMetadataClient(
+		annotatedObject("apps/v1", "Deployment", "web", `{"image": "nginx"}`),
+		annotatedObject("apps/v1", "Deployment", "worker", `["debian"]`),
+	)
+
+	src := source.NewAnnotationSource(fakeClient, time.Minute*15, []schema.GroupVersionResource{deploymentResource})
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"debian"})
+}
+
+func Test_AnnotationSource_Name(t *testing.T) {
+	src := source.NewAnnotationSource(newFakeMetadataClient(), time.Minute*15, nil)
+
+	assert.Equal(t, "Annotation", src.Name())
+}
@@ -0,0 +1,152 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	argoconfig "github.com/argoproj/argo-workflows/v3/config"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+// rawWorkflowControllerConfig returns the config stored in the workflow controller ConfigMap the same
+// way that the controller reads it; either the entire config is stored in a single "config" key, or
+// each top level field is stored in its own key.
+func rawWorkflowControllerConfig(cm *corev1.ConfigMap) string {
+	rawConfig, ok := cm.Data["config"]
+
+	if !ok {
+		for name, value := range cm.Data {
+			if strings.Contains(value, "\n") {
+				rawConfig = rawConfig + name + ":\n  " + strings.Join(strings.Split(strings.Trim(value, "\n"), "\n"), "\n  ") + "\n"
+			} else {
+				rawConfig = rawConfig + name + ": " + value + "\n"
+			}
+		}
+	}
+
+	return rawConfig
+}
+
+// parseWorkflowControllerConfig parses the workflow controller ConfigMap
+func parseWorkflowControllerConfig(cm *corev1.ConfigMap) (*argoconfig.Config, error) {
+	config := &argoconfig.Config{}
+
+	if err := yaml.Unmarshal([]byte(rawWorkflowControllerConfig(cm)), config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow controller configmap %s/%s: %v", cm.Namespace, cm.Name, err)
+	}
+
+	return config, nil
+}
+
+// artifactRepositoryFields are the top level fields of the workflow controller config that configure
+// artifact repositories.  Newer versions of Argo than the one that this daemon is built against run
+// artifact drivers as sidecars of their own image.
+var artifactRepositoryFields = []string{"artifactRepository", "artifactDrivers"}
+
+// getArtifactRepositoryImages returns every image that the artifact repository fields of the workflow
+// controller ConfigMap define, at any depth, so that images added by versions of Argo that this
+// daemon does not know about are cached too
+func getArtifactRepositoryImages(cm *corev1.ConfigMap) (map[string]bool, error) {
+	var config map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(rawWorkflowControllerConfig(cm)), &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow controller configmap %s/%s: %v", cm.Namespace, cm.Name, err)
+	}
+
+	imageMap := make(map[string]bool)
+
+	for _, field := range artifactRepositoryFields {
+		collectImageFields(config[field], imageMap)
+	}
+
+	return imageMap, nil
+}
+
+// collectImageFields adds the value of every "image" field found within value to imageMap
+func collectImageFields(value interface{}, imageMap map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if image, ok := field.(string); ok && key == "image" && image != "" {
+				imageMap[image] = true
+				continue
+			}
+
+			collectImageFields(field, imageMap)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectImageFields(item, imageMap)
+		}
+	}
+}
+
+func getImagesFromWorkflowControllerConfigMapFn(name, defaultExecutorImage string) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		cm, ok := obj.(*corev1.ConfigMap)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to corev1.ConfigMap")
+		}
+
+		if cm.Name != name {
+			return make(map[string]bool), nil
+		}
+
+		config, err := parseWorkflowControllerConfig(cm)
+
+		if err != nil {
+			return nil, err
+		}
+
+		imageMap, err := getArtifactRepositoryImages(cm)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The executor runs as the init and wait containers of every pod.  When the ConfigMap sets no
+		// executor image, the controller uses the one that it was built with, which cannot be read
+		// from the ConfigMap.
+		if config.ExecutorImage != "" {
+			imageMap[config.ExecutorImage] = true
+		}
+
+		if config.Executor != nil && config.Executor.Image != "" {
+			imageMap[config.Executor.Image] = true
+		}
+
+		if config.ExecutorImage == "" && (config.Executor == nil || config.Executor.Image == "") && defaultExecutorImage != "" {
+			imageMap[defaultExecutorImage] = true
+		}
+
+		if config.MainContainer != nil && config.MainContainer.Image != "" {
+			imageMap[config.MainContainer.Image] = true
+		}
+
+		return imageMap, nil
+	}
+}
+
+// NewArgoExecutorSource creates a source that emits the executor images configured in the workflow
+// controller ConfigMap identified by namespace and name.  defaultExecutorImage is emitted instead when
+// the ConfigMap sets no executor image, and may be empty to emit none.
+func NewArgoExecutorSource(client kubernetes.Interface, resyncPeriod time.Duration, namespace, name, defaultExecutorImage string) ImageSource {
+	fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+		lo.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}))
+
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName:              "ArgoExecutor",
+		informers:               []cache.SharedIndexInformer{fac.Core().V1().ConfigMaps().Informer()},
+		extractImagesFromObject: getImagesFromWorkflowControllerConfigMapFn(name, defaultExecutorImage),
+		resyncPeriod:            resyncPeriod,
+	})
+}
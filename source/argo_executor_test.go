@@ -0,0 +1,221 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func Test_ArgoExecutorSource_Keys(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	controllerConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "workflow-controller-configmap",
+			Namespace: "argo",
+		},
+		Data: map[string]string{
+			"containerRuntimeExecutor": "emissary",
+			"executor": `image: quay.io/argoproj/argoexec:v3.2.11
+imagePullPolicy: IfNotPresent
+`,
+			"mainContainer": `image: alpine
+`,
+		},
+	}
+
+	otherConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other",
+			Namespace: "argo",
+		},
+		Data: map[string]string{
+			"executor": `image: debian
+`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&controllerConfigMap, &otherConfigMap)
+	src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"quay.io/argoproj/argoexec:v3.2.11", "alpine"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"quay.io/argoproj/argoexec:v3.2.11", "alpine"})
+}
+
+func Test_ArgoExecutorSource_Config(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	controllerConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "workflow-controller-configmap",
+			Namespace: "argo",
+		},
+		Data: map[string]string{
+			"config": `executorImage: argoproj/argoexec:v3.0.0
+executor:
+  image: quay.io/argoproj/argoexec:v3.2.11
+`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&controllerConfigMap)
+	src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"argoproj/argoexec:v3.0.0", "quay.io/argoproj/argoexec:v3.2.11"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_ArgoExecutorSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	controllerConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "workflow-controller-configmap",
+			Namespace: "argo",
+		},
+		Data: map[string]string{
+			"executor": `image: quay.io/argoproj/argoexec:v3.2.10
+`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&controllerConfigMap)
+	src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "")
+
+	go src.Run(ctx)
+
+	argoExecutorSource := src.(*source.InformerSource)
+
+	for !argoExecutorSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	controllerConfigMap.Data["executor"] = `image: quay.io/argoproj/argoexec:v3.2.11
+`
+
+	_, err := fakeClient.CoreV1().ConfigMaps("argo").Update(ctx, &controllerConfigMap, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"quay.io/argoproj/argoexec:v3.2.10", "quay.io/argoproj/argoexec:v3.2.11"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"quay.io/argoproj/argoexec:v3.2.11"})
+}
+
+func Test_ArgoExecutorSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "")
+
+	assert.Equal(t, "ArgoExecutor", src.Name())
+}
+
+func Test_ArgoExecutorSource_DefaultImage(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     map[string]string
+		expected []string
+	}{
+		{
+			name:     "no executor image",
+			data:     map[string]string{"containerRuntimeExecutor": "emissary"},
+			expected: []string{"quay.io/argoproj/argoexec:v3.2.11"},
+		},
+		{
+			name: "executor without an image",
+			data: map[string]string{"executor": `imagePullPolicy: IfNotPresent
+`},
+			expected: []string{"quay.io/argoproj/argoexec:v3.2.11"},
+		},
+		{
+			name: "executor image",
+			data: map[string]string{"executor": `image: quay.io/argoproj/argoexec:v3.2.10
+`},
+			expected: []string{"quay.io/argoproj/argoexec:v3.2.10"},
+		},
+		{
+			name:     "legacy executor image",
+			data:     map[string]string{"executorImage": "argoproj/argoexec:v3.0.0"},
+			expected: []string{"argoproj/argoexec:v3.0.0"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+			t.Cleanup(cancel)
+
+			controllerConfigMap := corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "workflow-controller-configmap",
+					Namespace: "argo",
+				},
+				Data: tc.data,
+			}
+
+			fakeClient := fake.NewSimpleClientset(&controllerConfigMap)
+			src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "quay.io/argoproj/argoexec:v3.2.11")
+
+			go src.Run(ctx)
+
+			assert.ElementsMatch(t, tc.expected, addedImages(src))
+			assert.Len(t, src.Events(), 0)
+		})
+	}
+}
+
+func Test_ArgoExecutorSource_ArtifactRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	controllerConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "workflow-controller-configmap",
+			Namespace: "argo",
+		},
+		Data: map[string]string{
+			"executor": `image: quay.io/argoproj/argoexec:v3.2.11
+`,
+			"artifactRepository": `s3:
+  bucket: my-bucket
+  endpoint: s3.amazonaws.com
+  plugin:
+    image: example.com/s3-plugin:v1
+`,
+			"artifactDrivers": `- name: my-driver
+  image: example.com/artifact-driver:v1
+- name: no-image
+`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&controllerConfigMap)
+	src := source.NewArgoExecutorSource(fakeClient, time.Minute*15, "argo", "workflow-controller-configmap", "")
+
+	go src.Run(ctx)
+
+	assert.ElementsMatch(t, []string{"quay.io/argoproj/argoexec:v3.2.11", "example.com/s3-plugin:v1", "example.com/artifact-driver:v1"}, addedImages(src))
+	assert.Len(t, src.Events(), 0)
+}
@@ -0,0 +1,305 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	argoclientset "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
+	argoinformers "github.com/argoproj/argo-workflows/v3/pkg/client/informers/externalversions"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TemplateResolver follows templateRef and workflowTemplateRef references into the WorkflowTemplate
+// and ClusterWorkflowTemplate informer caches so that the templates they point to contribute images
+// to the objects that reference them.
+type TemplateResolver struct {
+	logger                          *logrus.Logger
+	clusterWorkflowTemplateInformer cache.SharedIndexInformer
+
+	// workflowTemplateInformers holds the WorkflowTemplate informer of every namespace in scope, or a
+	// single informer for v1.NamespaceAll if the resolver has no scope
+	workflowTemplateInformers *scopedInformers
+	handlers                  []func(key string)
+	lock                      sync.RWMutex
+}
+
+func NewTemplateResolver(client argoclientset.Interface, resyncPeriod time.Duration) *TemplateResolver {
+	fac := argoinformers.NewSharedInformerFactory(client, resyncPeriod)
+
+	r := &TemplateResolver{
+		logger:                          logrus.StandardLogger(),
+		clusterWorkflowTemplateInformer: fac.Argoproj().V1alpha1().ClusterWorkflowTemplates().Informer(),
+		workflowTemplateInformers:       newScopedInformers(),
+	}
+
+	r.workflowTemplateInformers.newInformers = func(namespace string) []imageInformer {
+		fac := argoinformers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, argoinformers.WithNamespace(namespace))
+		return newImageInformers(nil, fac.Argoproj().V1alpha1().WorkflowTemplates().Informer())
+	}
+
+	r.workflowTemplateInformers.onStart = func(sn *scopedNamespace) {
+		for _, ii := range sn.informers {
+			ii.informer.AddEventHandler(r.eventHandler())
+		}
+	}
+
+	r.clusterWorkflowTemplateInformer.AddEventHandler(r.eventHandler())
+
+	return r
+}
+
+// SetNamespaceScope restricts the WorkflowTemplates that references are resolved against to the
+// namespaces of scope.  Must be called before Run.
+func (r *TemplateResolver) SetNamespaceScope(scope *NamespaceScope) {
+	r.workflowTemplateInformers.scope = scope
+}
+
+func (r *TemplateResolver) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		r.clusterWorkflowTemplateInformer.Run(ctx.Done())
+	}()
+
+	go func() {
+		defer wg.Done()
+		r.workflowTemplateInformers.run(ctx)
+	}()
+
+	wg.Wait()
+}
+
+func (r *TemplateResolver) HasSynced() bool {
+	return r.workflowTemplateInformers.hasSynced() && r.clusterWorkflowTemplateInformer.HasSynced()
+}
+
+// AddEventHandler registers fn to be called with the reference key (see templateReferenceKey) of
+// any WorkflowTemplate or ClusterWorkflowTemplate that is added, updated or deleted.
+func (r *TemplateResolver) AddEventHandler(fn func(key string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.handlers = append(r.handlers, fn)
+}
+
+// eventHandler notifies every handler registered with AddEventHandler, including those registered
+// after the informer was started
+func (r *TemplateResolver) eventHandler() cache.ResourceEventHandler {
+	handler := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+
+		var key string
+
+		switch tmpl := obj.(type) {
+		case *argov1alpha1.WorkflowTemplate:
+			key = templateReferenceKey(false, tmpl.Namespace, tmpl.Name)
+		case *argov1alpha1.ClusterWorkflowTemplate:
+			key = templateReferenceKey(true, "", tmpl.Name)
+		default:
+			return
+		}
+
+		r.lock.RLock()
+		handlers := r.handlers
+		r.lock.RUnlock()
+
+		for _, fn := range handlers {
+			fn(key)
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: handler,
+		UpdateFunc: func(_, newObj interface{}) {
+			handler(newObj)
+		},
+		DeleteFunc: handler,
+	}
+}
+
+func templateReferenceKey(clusterScope bool, namespace, name string) string {
+	if clusterScope {
+		return fmt.Sprintf("ClusterWorkflowTemplate/%s", name)
+	}
+
+	return fmt.Sprintf("WorkflowTemplate/%s/%s", namespace, name)
+}
+
+func (r *TemplateResolver) getWorkflowSpec(clusterScope bool, namespace, name string) *argov1alpha1.WorkflowSpec {
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	indexer := r.workflowTemplateIndexer(namespace)
+
+	if clusterScope {
+		indexer = r.clusterWorkflowTemplateInformer.GetIndexer()
+		key = name
+	}
+
+	// WorkflowTemplates outside of the namespace scope are never resolved
+	if indexer == nil {
+		r.logger.Debugf("referenced template %s is not in a watched namespace", templateReferenceKey(clusterScope, namespace, name))
+		return nil
+	}
+
+	value, exists, err := indexer.GetByKey(key)
+
+	if err != nil {
+		r.logger.Errorf("failed to retrieve key %s from indexer: %v", key, err)
+		return nil
+	}
+
+	if !exists {
+		r.logger.Debugf("referenced template %s does not exist", templateReferenceKey(clusterScope, namespace, name))
+		return nil
+	}
+
+	switch tmpl := value.(type) {
+	case *argov1alpha1.WorkflowTemplate:
+		return &tmpl.Spec.WorkflowSpec
+	case *argov1alpha1.ClusterWorkflowTemplate:
+		return &tmpl.Spec.WorkflowSpec
+	default:
+		return nil
+	}
+}
+
+// workflowTemplateIndexer returns the indexer holding the WorkflowTemplates of namespace, or nil if
+// namespace is not watched
+func (r *TemplateResolver) workflowTemplateIndexer(namespace string) cache.Indexer {
+	for _, ii := range r.workflowTemplateInformers.forNamespace(namespace) {
+		return ii.informer.GetIndexer()
+	}
+
+	return nil
+}
+
+func findTemplate(spec *argov1alpha1.WorkflowSpec, name string) *argov1alpha1.Template {
+	for idx := range spec.Templates {
+		if spec.Templates[idx].Name == name {
+			return &spec.Templates[idx]
+		}
+	}
+
+	return nil
+}
+
+type templateWalker struct {
+	resolver   *TemplateResolver
+	namespace  string
+	visited    map[string]bool
+	resolved   []argov1alpha1.Template
+	parameters []argov1alpha1.Parameter
+	refs       map[string]bool
+}
+
+// walkReferences follows every templateRef used by the steps and DAG tasks of tmpl, including those
+// of templates defined inline.  Local template references are only followed when spec is given, since
+// the templates of the object being resolved are already included by the caller.
+func (w *templateWalker) walkReferences(tmpl *argov1alpha1.Template, spec *argov1alpha1.WorkflowSpec, specKey string) {
+	visit := func(templateName string, templateRef *argov1alpha1.TemplateRef, inline *argov1alpha1.Template) {
+		if templateRef != nil {
+			w.walkTemplateRef(templateRef)
+		} else if inline != nil {
+			w.walkReferences(inline, spec, specKey)
+		} else if spec != nil && templateName != "" {
+			w.walkLocalTemplate(spec, specKey, templateName)
+		}
+	}
+
+	for _, parallelSteps := range tmpl.Steps {
+		for _, step := range parallelSteps.Steps {
+			visit(step.Template, step.TemplateRef, step.Inline)
+		}
+	}
+
+	if tmpl.DAG != nil {
+		for _, task := range tmpl.DAG.Tasks {
+			visit(task.Template, task.TemplateRef, task.Inline)
+		}
+	}
+}
+
+func (w *templateWalker) walkLocalTemplate(spec *argov1alpha1.WorkflowSpec, specKey, name string) {
+	visitedKey := fmt.Sprintf("%s/%s", specKey, name)
+
+	if w.visited[visitedKey] {
+		return
+	}
+
+	w.visited[visitedKey] = true
+
+	if tmpl := findTemplate(spec, name); tmpl != nil {
+		w.resolved = append(w.resolved, *tmpl)
+		w.walkReferences(tmpl, spec, specKey)
+	}
+}
+
+func (w *templateWalker) walkTemplateRef(ref *argov1alpha1.TemplateRef) {
+	specKey := templateReferenceKey(ref.ClusterScope, w.namespace, ref.Name)
+	w.refs[specKey] = true
+
+	if spec := w.resolver.getWorkflowSpec(ref.ClusterScope, w.namespace, ref.Name); spec != nil {
+		w.walkLocalTemplate(spec, specKey, ref.Template)
+	}
+}
+
+func (w *templateWalker) walkWorkflowTemplateRef(ref *argov1alpha1.WorkflowTemplateRef) {
+	specKey := templateReferenceKey(ref.ClusterScope, w.namespace, ref.Name)
+	w.refs[specKey] = true
+
+	if spec := w.resolver.getWorkflowSpec(ref.ClusterScope, w.namespace, ref.Name); spec != nil {
+		w.parameters = append(w.parameters, spec.Arguments.Parameters...)
+
+		for idx := range spec.Templates {
+			w.walkLocalTemplate(spec, specKey, spec.Templates[idx].Name)
+		}
+	}
+}
+
+// ResolvedTemplates holds everything reachable from an object through template references
+type ResolvedTemplates struct {
+	// Templates are the referenced templates, not including those of the object itself
+	Templates []argov1alpha1.Template
+	// Parameters are the workflow-level parameters of a referenced workflowTemplateRef
+	Parameters []argov1alpha1.Parameter
+	// References are the keys of every WorkflowTemplate and ClusterWorkflowTemplate that was consulted
+	References []string
+}
+
+// ResolveTemplates returns the templates reachable from templates (and workflowTemplateRef, if set)
+// through templateRef and workflowTemplateRef references, following references inside referenced
+// templates as well.
+func (r *TemplateResolver) ResolveTemplates(namespace string, templates []argov1alpha1.Template, workflowTemplateRef *argov1alpha1.WorkflowTemplateRef) *ResolvedTemplates {
+	w := &templateWalker{
+		resolver:  r,
+		namespace: namespace,
+		visited:   make(map[string]bool),
+		refs:      make(map[string]bool),
+	}
+
+	for idx := range templates {
+		w.walkReferences(&templates[idx], nil, "")
+	}
+
+	if workflowTemplateRef != nil {
+		w.walkWorkflowTemplateRef(workflowTemplateRef)
+	}
+
+	resolved := &ResolvedTemplates{
+		Templates:  w.resolved,
+		Parameters: w.parameters,
+	}
+
+	for key := range w.refs {
+		resolved.References = append(resolved.References, key)
+	}
+
+	return resolved
+}
@@ -0,0 +1,266 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	fake "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	"github.com/dcherman/image-cache-daemon/source"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func containerTemplate(name, image string) argov1alpha1.Template {
+	return argov1alpha1.Template{
+		Name: name,
+		Container: &v1.Container{
+			Image: image,
+		},
+	}
+}
+
+func stepsTemplate(name string, steps ...argov1alpha1.WorkflowStep) argov1alpha1.Template {
+	return argov1alpha1.Template{
+		Name: name,
+		Steps: []argov1alpha1.ParallelSteps{
+			{
+				Steps: steps,
+			},
+		},
+	}
+}
+
+func Test_TemplateResolver_TemplateRef(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cron",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					stepsTemplate("main", argov1alpha1.WorkflowStep{
+						TemplateRef: &argov1alpha1.TemplateRef{
+							Name:     "shared",
+							Template: "entry",
+						},
+					}),
+				},
+			},
+		},
+	}
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "shared",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					stepsTemplate("entry",
+						argov1alpha1.WorkflowStep{
+							Template: "local",
+						},
+						argov1alpha1.WorkflowStep{
+							TemplateRef: &argov1alpha1.TemplateRef{
+								Name:         "cluster",
+								Template:     "dag",
+								ClusterScope: true,
+							},
+						},
+					),
+					containerTemplate("local", "alpine"),
+					containerTemplate("unused", "centos"),
+				},
+			},
+		},
+	}
+
+	clusterWorkflowTemplate := argov1alpha1.ClusterWorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Name: "dag",
+						DAG: &argov1alpha1.DAGTemplate{
+							Tasks: []argov1alpha1.DAGTask{
+								{
+									Name:     "debian",
+									Template: "debian",
+								},
+								{
+									Name: "self",
+									TemplateRef: &argov1alpha1.TemplateRef{
+										Name:         "cluster",
+										Template:     "dag",
+										ClusterScope: true,
+									},
+								},
+							},
+						},
+					},
+					containerTemplate("debian", "debian"),
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow, &workflowTemplate, &clusterWorkflowTemplate)
+
+	resolver := source.NewTemplateResolver(fakeClient, time.Minute*15)
+	go resolver.Run(ctx)
+
+	for !resolver.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15, source.WithTemplateResolver(resolver))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_TemplateResolver_WorkflowTemplateRef(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cron",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				WorkflowTemplateRef: &argov1alpha1.WorkflowTemplateRef{
+					Name: "shared",
+				},
+			},
+		},
+	}
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "shared",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					containerTemplate("first", "alpine"),
+					containerTemplate("second", "debian"),
+				},
+			},
+		},
+	}
+
+	otherNamespaceTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "shared",
+			Namespace: "other",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					containerTemplate("first", "ubuntu"),
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow, &workflowTemplate, &otherNamespaceTemplate)
+
+	resolver := source.NewTemplateResolver(fakeClient, time.Minute*15)
+	go resolver.Run(ctx)
+
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15, source.WithTemplateResolver(resolver))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_TemplateResolver_ReferencedTemplateModify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cron",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					stepsTemplate("main", argov1alpha1.WorkflowStep{
+						TemplateRef: &argov1alpha1.TemplateRef{
+							Name:     "shared",
+							Template: "entry",
+						},
+					}),
+				},
+			},
+		},
+	}
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "shared",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					containerTemplate("entry", "alpine"),
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow, &workflowTemplate)
+
+	resolver := source.NewTemplateResolver(fakeClient, time.Minute*15)
+	go resolver.Run(ctx)
+
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15, source.WithTemplateResolver(resolver))
+
+	go src.Run(ctx)
+
+	argoSource := src.(*source.ArgoTemplateSource)
+
+	for !argoSource.HasSynced() || !resolver.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	workflowTemplate.Spec.WorkflowSpec.Templates[0].Container.Image = "debian"
+
+	_, err := fakeClient.ArgoprojV1alpha1().WorkflowTemplates("default").Update(ctx, &workflowTemplate, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"debian"})
+}
@@ -0,0 +1,222 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	argoRolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	deploymentResource  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// getImagesFromPodTemplateField converts the pod template found at fields of obj and returns its images
+func getImagesFromPodTemplateField(obj *unstructured.Unstructured, fields ...string) (map[string]bool, error) {
+	raw, found, err := unstructured.NestedMap(obj.Object, fields...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return make(map[string]bool), nil
+	}
+
+	var template corev1.PodTemplateSpec
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &template); err != nil {
+		return nil, err
+	}
+
+	return getImageSetFromPodSpec(&template.Spec), nil
+}
+
+// getImagesFromArgoRolloutFn returns the images of the pod template of a Rollout.  Rollouts that
+// reference a Deployment through spec.workloadRef use the pod template of that Deployment, which is
+// looked up in deployments.
+func getImagesFromArgoRolloutFn(deployments cache.Indexer) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		rollout, ok := obj.(*unstructured.Unstructured)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+		}
+
+		workloadRef, found, err := unstructured.NestedStringMap(rollout.Object, "spec", "workloadRef")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spec.workloadRef of rollout %s/%s: %v", rollout.GetNamespace(), rollout.GetName(), err)
+		}
+
+		if !found {
+			imageMap, err := getImagesFromPodTemplateField(rollout, "spec", "template")
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read spec.template of rollout %s/%s: %v", rollout.GetNamespace(), rollout.GetName(), err)
+			}
+
+			return imageMap, nil
+		}
+
+		if workloadRef["kind"] != "Deployment" {
+			return nil, fmt.Errorf("rollout %s/%s references unsupported workload kind %q", rollout.GetNamespace(), rollout.GetName(), workloadRef["kind"])
+		}
+
+		item, exists, err := deployments.GetByKey(rollout.GetNamespace() + "/" + workloadRef["name"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The Deployment may not have been observed yet, in which case its images are emitted once it is
+		if !exists {
+			return make(map[string]bool), nil
+		}
+
+		deployment, ok := item.(*unstructured.Unstructured)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast deployment to unstructured.Unstructured")
+		}
+
+		imageMap, err := getImagesFromPodTemplateField(deployment, "spec", "template")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spec.template of deployment %s/%s: %v", deployment.GetNamespace(), deployment.GetName(), err)
+		}
+
+		return imageMap, nil
+	}
+}
+
+// rolloutWorkloadRefIndex indexes Rollouts by the key of the Deployment referenced by spec.workloadRef
+const rolloutWorkloadRefIndex = "workloadRef"
+
+func indexByWorkloadRef(obj interface{}) ([]string, error) {
+	rollout, ok := obj.(*unstructured.Unstructured)
+
+	if !ok {
+		return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+	}
+
+	workloadRef, found, err := unstructured.NestedStringMap(rollout.Object, "spec", "workloadRef")
+
+	if err != nil || !found || workloadRef["kind"] != "Deployment" {
+		return nil, nil
+	}
+
+	return []string{rollout.GetNamespace() + "/" + workloadRef["name"]}, nil
+}
+
+// isUnreferencedDeploymentFn returns whether a Deployment is not referenced by any Rollout in rollouts,
+// in which case it contributes no images
+func isUnreferencedDeploymentFn(rollouts cache.Indexer) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+
+		if err != nil {
+			return false
+		}
+
+		referencing, err := rollouts.ByIndex(rolloutWorkloadRefIndex, key)
+
+		return err == nil && len(referencing) == 0
+	}
+}
+
+// getImagesFromReferencedDeploymentFn returns the images of the pod template of a Deployment that is
+// referenced by a Rollout in rollouts
+func getImagesFromReferencedDeploymentFn(rollouts cache.Indexer) func(obj interface{}) (map[string]bool, error) {
+	isUnreferenced := isUnreferencedDeploymentFn(rollouts)
+
+	return func(obj interface{}) (map[string]bool, error) {
+		deployment, ok := obj.(*unstructured.Unstructured)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+		}
+
+		if isUnreferenced(deployment) {
+			return make(map[string]bool), nil
+		}
+
+		imageMap, err := getImagesFromPodTemplateField(deployment, "spec", "template")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spec.template of deployment %s/%s: %v", deployment.GetNamespace(), deployment.GetName(), err)
+		}
+
+		return imageMap, nil
+	}
+}
+
+// isPodTemplateUnchanged returns whether an update of a Deployment left its pod template unchanged,
+// which is the case for every status update
+func isPodTemplateUnchanged(oldObj, newObj interface{}) bool {
+	oldDeployment, ok := oldObj.(*unstructured.Unstructured)
+
+	if !ok {
+		return false
+	}
+
+	newDeployment, ok := newObj.(*unstructured.Unstructured)
+
+	if !ok {
+		return false
+	}
+
+	oldTemplate, _, oldErr := unstructured.NestedFieldNoCopy(oldDeployment.Object, "spec", "template")
+	newTemplate, _, newErr := unstructured.NestedFieldNoCopy(newDeployment.Object, "spec", "template")
+
+	return oldErr == nil && newErr == nil && equality.Semantic.DeepEqual(oldTemplate, newTemplate)
+}
+
+// NewArgoRolloutSource creates a source that emits the images of the pod template of every Argo
+// Rollout matching selector.  Since a new revision of a Rollout initially runs on only a handful of
+// nodes, this gives every other node a head start before the Rollout is promoted.
+func NewArgoRolloutSource(client dynamic.Interface, resyncPeriod time.Duration, selector string) ImageSource {
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "ArgoRollout",
+		namespacedInformers: func(namespace string) []imageInformer {
+			rolloutFac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			})
+
+			rolloutInformer := rolloutFac.ForResource(argoRolloutResource).Informer()
+
+			if err := rolloutInformer.AddIndexers(cache.Indexers{rolloutWorkloadRefIndex: indexByWorkloadRef}); err != nil {
+				logrus.Errorf("failed to add the workloadRef index: %v", err)
+			}
+
+			deploymentFac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, nil)
+			deploymentInformer := deploymentFac.ForResource(deploymentResource).Informer()
+
+			// Deployments only contribute images through the Rollouts that reference them, so the events
+			// of every other Deployment, and any update that leaves the pod template alone, are skipped
+			return []imageInformer{
+				{
+					informer:                rolloutInformer,
+					extractImagesFromObject: getImagesFromArgoRolloutFn(deploymentInformer.GetIndexer()),
+				},
+				{
+					informer:                deploymentInformer,
+					extractImagesFromObject: getImagesFromReferencedDeploymentFn(rolloutInformer.GetIndexer()),
+					ignore:                  isUnreferencedDeploymentFn(rolloutInformer.GetIndexer()),
+					ignoreUpdate:            isPodTemplateUnchanged,
+				},
+			}
+		},
+		resyncPeriod: resyncPeriod,
+	})
+}
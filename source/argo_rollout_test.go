@@ -0,0 +1,240 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+var rolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+func podTemplate(images ...string) map[string]interface{} {
+	containers := make([]interface{}, 0, len(images))
+
+	for _, image := range images {
+		containers = append(containers, map[string]interface{}{
+			"name":  "main",
+			"image": image,
+		})
+	}
+
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": containers,
+		},
+	}
+}
+
+func argoRollout(name string, labels map[string]string, images ...string) *unstructured.Unstructured {
+	rollout := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"template": podTemplate(images...),
+			},
+		},
+	}
+
+	rollout.SetLabels(labels)
+
+	return rollout
+}
+
+func argoWorkloadRefRollout(name, deployment string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"workloadRef": map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"name":       deployment,
+				},
+			},
+		},
+	}
+}
+
+func unstructuredDeployment(name string, images ...string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(0),
+				"template": podTemplate(images...),
+			},
+		},
+	}
+}
+
+func newFakeRolloutClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		rolloutResource:    "RolloutList",
+		deploymentResource: "DeploymentList",
+	}, objects...)
+}
+
+func Test_ArgoRolloutSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeRolloutClient(
+		argoRollout("app", nil, "app:v1", "envoy:1.19"),
+		argoWorkloadRefRollout("ref", "ref-deployment"),
+		unstructuredDeployment("ref-deployment", "ref:v1"),
+		unstructuredDeployment("unreferenced", "unreferenced:v1"),
+	)
+
+	src := source.NewArgoRolloutSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"app:v1", "envoy:1.19", "ref:v1"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"app:v1", "envoy:1.19", "ref:v1"})
+}
+
+func Test_ArgoRolloutSource_Selector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeRolloutClient(
+		argoRollout("app", map[string]string{"cache": "true"}, "app:v1"),
+		argoRollout("other", nil, "other:v1"),
+	)
+
+	src := source.NewArgoRolloutSource(fakeClient, time.Minute*15, "cache=true")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"app:v1"})
+}
+
+func Test_ArgoRolloutSource_NewRevision(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeRolloutClient(argoRollout("app", nil, "app:v1", "envoy:1.19"))
+
+	src := source.NewArgoRolloutSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	rolloutSource := src.(*source.InformerSource)
+
+	for !rolloutSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_, err := fakeClient.Resource(rolloutResource).Namespace("default").Update(ctx, argoRollout("app", nil, "app:v2", "envoy:1.19"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"app:v1", "envoy:1.19", "app:v2"})
+	assert.ElementsMatch(t, src.Images(), []string{"app:v2", "envoy:1.19"})
+}
+
+func Test_ArgoRolloutSource_WorkloadRefNewRevision(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeRolloutClient(
+		argoWorkloadRefRollout("ref", "ref-deployment"),
+		unstructuredDeployment("ref-deployment", "ref:v1"),
+	)
+
+	src := source.NewArgoRolloutSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	rolloutSource := src.(*source.InformerSource)
+
+	for !rolloutSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_, err := fakeClient.Resource(deploymentResource).Namespace("default").Update(ctx, unstructuredDeployment("ref-deployment", "ref:v2"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"ref:v1", "ref:v2"})
+	assert.ElementsMatch(t, src.Images(), []string{"ref:v2"})
+}
+
+func Test_ArgoRolloutSource_UnreferencedDeployments(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeRolloutClient(
+		argoWorkloadRefRollout("ref", "ref-deployment"),
+		unstructuredDeployment("ref-deployment", "ref:v1"),
+		unstructuredDeployment("other", "other:v1"),
+	)
+
+	src := source.NewArgoRolloutSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	rolloutSource := src.(*source.InformerSource)
+
+	for !rolloutSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// A status update leaves the pod template of the referenced Deployment alone
+	deployment := unstructuredDeployment("ref-deployment", "ref:v1")
+	assert.NoError(t, unstructured.SetNestedField(deployment.Object, int64(3), "status", "replicas"))
+
+	_, err := fakeClient.Resource(deploymentResource).Namespace("default").Update(ctx, deployment, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	_, err = fakeClient.Resource(deploymentResource).Namespace("default").Update(ctx, unstructuredDeployment("other", "other:v2"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	err = fakeClient.Resource(deploymentResource).Namespace("default").Delete(ctx, "other", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"ref:v1"}, addedImages(src))
+	assert.ElementsMatch(t, src.Images(), []string{"ref:v1"})
+}
+
+func Test_ArgoRolloutSource_Name(t *testing.T) {
+	src := source.NewArgoRolloutSource(newFakeRolloutClient(), time.Minute*15, "")
+
+	assert.Equal(t, "ArgoRollout", src.Name())
+}
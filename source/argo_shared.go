@@ -2,7 +2,8 @@ package source
 
 import (
 	"context"
-	"sync"
+	"fmt"
+	"strings"
 	"time"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
@@ -12,145 +13,231 @@ import (
 )
 
 type ArgoTemplateSourceOpts struct {
-	sourceName                 string
-	extractTemplatesFromObject func(obj interface{}) []argov1alpha1.Template
-	informer                   cache.SharedIndexInformer
-	resyncPeriod               time.Duration
-	client                     argoclientset.Interface
+	sourceName                           string
+	extractTemplatesFromObject           func(obj interface{}) []argov1alpha1.Template
+	extractWorkflowTemplateRefFromObject func(obj interface{}) *argov1alpha1.WorkflowTemplateRef
+	extractArgumentsFromObject           func(obj interface{}) argov1alpha1.Arguments
+	informer                             cache.SharedIndexInformer
+	namespacedInformer                   func(namespace string) cache.SharedIndexInformer
+	resyncPeriod                         time.Duration
+	client                               argoclientset.Interface
+	resolver                             *TemplateResolver
+	cronWindow                           *CronWindow
+
+	// includeObject, if set, decides whether an object currently contributes any images
+	includeObject func(obj interface{}) (bool, error)
 }
 
-func NewArgoTemplateSource(opts *ArgoTemplateSourceOpts) ImageSource {
-	return &ArgoTemplateSource{
-		sourceName:                 opts.sourceName,
-		informer:                   opts.informer,
-		lock:                       sync.RWMutex{},
-		imageMap:                   make(map[string]bool),
-		images:                     make([]string, 0),
-		extractTemplatesFromObject: opts.extractTemplatesFromObject,
-		imageCh:                    make(chan string),
-		client:                     opts.client,
-		resyncPeriod:               opts.resyncPeriod,
+type ArgoOptFn func(opts *ArgoTemplateSourceOpts)
+
+// WithTemplateResolver resolves templateRef and workflowTemplateRef references using resolver.  The
+// resolver must be run separately, and may be shared between sources.
+func WithTemplateResolver(resolver *TemplateResolver) ArgoOptFn {
+	return func(opts *ArgoTemplateSourceOpts) {
+		opts.resolver = resolver
 	}
 }
 
-type ArgoTemplateSource struct {
-	sourceName                 string
-	extractTemplatesFromObject func(obj interface{}) []argov1alpha1.Template
-	client                     argoclientset.Interface
-	imageCh                    chan string
-	resyncPeriod               time.Duration
-
-	informer cache.SharedIndexInformer
-	imageMap map[string]bool
-	images   []string
-	lock     sync.RWMutex
+// WithCronWindow only emits the images of CronWorkflows around their runs.  Other sources ignore it.
+func WithCronWindow(window *CronWindow) ArgoOptFn {
+	return func(opts *ArgoTemplateSourceOpts) {
+		opts.cronWindow = window
+	}
 }
 
-func (t *ArgoTemplateSource) ImageCh() <-chan string {
-	return t.imageCh
-}
+func NewArgoTemplateSource(opts *ArgoTemplateSourceOpts) ImageSource {
+	t := &ArgoTemplateSource{
+		extractTemplatesFromObject:           opts.extractTemplatesFromObject,
+		extractWorkflowTemplateRefFromObject: opts.extractWorkflowTemplateRefFromObject,
+		extractArgumentsFromObject:           opts.extractArgumentsFromObject,
+		client:                               opts.client,
+		resolver:                             opts.resolver,
+		objectRefs:                           make(map[string][]string),
+		dependents:                           make(map[string]map[string]bool),
+		reportedUnresolved:                   make(map[string]bool),
+	}
 
-func (t *ArgoTemplateSource) Images() []string {
-	t.lock.RLock()
-	defer t.lock.RUnlock()
+	extractImagesFromObject := func(obj interface{}) (map[string]bool, error) {
+		if opts.includeObject != nil {
+			include, err := opts.includeObject(obj)
 
-	return t.images
-}
+			if err != nil {
+				return nil, err
+			}
 
-func (ats *ArgoTemplateSource) Name() string {
-	return ats.sourceName
-}
+			if !include {
+				return make(map[string]bool), nil
+			}
+		}
 
-func (t *ArgoTemplateSource) updateImagesFromInformer() {
-	t.imageMap = t.getImagesFromInformer()
+		return t.getImagesFromObject(obj), nil
+	}
 
-	var images []string
+	informerOpts := &InformerSourceOpts{
+		sourceName:   opts.sourceName,
+		resyncPeriod: opts.resyncPeriod,
+	}
 
-	for key := range t.imageMap {
-		images = append(images, key)
+	// Windows open and close as time passes, without any change to the objects
+	if opts.cronWindow != nil && opts.includeObject != nil {
+		informerOpts.recomputeInterval = cronRecomputeInterval
+		informerOpts.clock = opts.cronWindow.clock
 	}
 
-	t.images = images
+	t.InformerSource = NewInformerSource(informerOpts)
+
+	// Cluster scoped templates have a single informer, while namespaced objects are watched per namespace
+	if opts.namespacedInformer != nil {
+		t.namespacedInformers = func(namespace string) []imageInformer {
+			iis := newImageInformers(extractImagesFromObject, opts.namespacedInformer(namespace))
+
+			if informerOpts.recomputeInterval > 0 {
+				iis[0].due = func(obj interface{}) bool {
+					include, err := opts.includeObject(obj)
+					return err == nil && include
+				}
+			}
+
+			return iis
+		}
+	} else {
+		t.addInformer(opts.informer, extractImagesFromObject)
+	}
+
+	t.onDelete = t.forgetObject
+
+	return t
 }
 
-func (t *ArgoTemplateSource) getImagesFromInformer() map[string]bool {
-	imageMap := make(map[string]bool)
+type ArgoTemplateSource struct {
+	*InformerSource
+
+	extractTemplatesFromObject           func(obj interface{}) []argov1alpha1.Template
+	extractWorkflowTemplateRefFromObject func(obj interface{}) *argov1alpha1.WorkflowTemplateRef
+	extractArgumentsFromObject           func(obj interface{}) argov1alpha1.Arguments
+	client                               argoclientset.Interface
+	resolver                             *TemplateResolver
 
-	if t.informer != nil {
+	// objectRefs holds the templates referenced by each object, and dependents is the inverse
+	objectRefs map[string][]string
+	dependents map[string]map[string]bool
 
-		indexer := t.informer.GetIndexer()
+	// reportedUnresolved tracks which unresolvable images have already been logged for each object
+	reportedUnresolved map[string]bool
+}
 
-		for _, key := range indexer.ListKeys() {
-			value, exists, err := indexer.GetByKey(key)
+func (t *ArgoTemplateSource) setObjectRefs(key string, refs []string) {
+	for _, ref := range t.objectRefs[key] {
+		delete(t.dependents[ref], key)
 
-			if !exists {
-				logrus.Warnf("key %s did not exist in indexer", key)
-			} else if err != nil {
-				logrus.Errorf("failed to retrieve key %s from indexer: %v", key, err)
-			} else {
-				for image := range getImageSetFromTemplates(t.extractTemplatesFromObject(value)) {
-					imageMap[image] = true
-				}
-			}
+		if len(t.dependents[ref]) == 0 {
+			delete(t.dependents, ref)
 		}
 	}
 
-	return imageMap
+	if len(refs) == 0 {
+		delete(t.objectRefs, key)
+		return
+	}
+
+	t.objectRefs[key] = refs
+
+	for _, ref := range refs {
+		if _, ok := t.dependents[ref]; !ok {
+			t.dependents[ref] = make(map[string]bool)
+		}
+
+		t.dependents[ref][key] = true
+	}
 }
 
-func (t *ArgoTemplateSource) HasSynced() bool {
-	if t.informer != nil {
-		return t.informer.HasSynced()
+// getImagesFromObject returns the images used by obj, including those found in any templates it
+// references.  Must be called with the lock held, since it records those references.
+func (t *ArgoTemplateSource) getImagesFromObject(obj interface{}) map[string]bool {
+	templates := t.extractTemplatesFromObject(obj)
+
+	var parameters []argov1alpha1.Parameter
+
+	if t.extractArgumentsFromObject != nil {
+		parameters = t.extractArgumentsFromObject(obj).Parameters
 	}
 
-	return false
-}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
 
-func (t *ArgoTemplateSource) Run(ctx context.Context) {
-	t.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			images := getImageSetFromTemplates(t.extractTemplatesFromObject(obj))
+	if err != nil {
+		logrus.Errorf("failed to get key for object: %v", err)
+	}
 
-			t.lock.Lock()
-			defer t.lock.Unlock()
+	if t.resolver != nil {
+		var workflowTemplateRef *argov1alpha1.WorkflowTemplateRef
 
-			newImages := setDifference(images, t.imageMap)
+		if t.extractWorkflowTemplateRefFromObject != nil {
+			workflowTemplateRef = t.extractWorkflowTemplateRefFromObject(obj)
+		}
 
-			for _, image := range newImages {
-				t.imageMap[image] = true
-				t.images = append(t.images, image)
-				t.imageCh <- image
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			previousImages := getImageSetFromTemplates(t.extractTemplatesFromObject(oldObj))
-			currentImages := getImageSetFromTemplates(t.extractTemplatesFromObject(newObj))
+		resolved := t.resolver.ResolveTemplates(namespaceOf(obj), templates, workflowTemplateRef)
 
-			deletedImages := setDifference(previousImages, currentImages)
+		if key != "" {
+			t.setObjectRefs(key, resolved.References)
+		}
 
-			t.lock.Lock()
-			defer t.lock.Unlock()
+		templates = append(append([]argov1alpha1.Template{}, templates...), resolved.Templates...)
+		parameters = append(append([]argov1alpha1.Parameter{}, parameters...), resolved.Parameters...)
+	}
 
-			newImages := setDifference(currentImages, t.imageMap)
+	images, unresolved := getImageSetFromTemplates(templates, parameters)
 
-			for _, image := range newImages {
-				t.imageMap[image] = true
-				t.images = append(t.images, image)
-				t.imageCh <- image
-			}
+	for _, image := range unresolved {
+		reportKey := fmt.Sprintf("%s/%s", key, image)
 
-			if len(deletedImages) > 0 {
-				t.updateImagesFromInformer()
-			}
-		},
-		DeleteFunc: func(_ interface{}) {
-			t.lock.Lock()
-			defer t.lock.Unlock()
+		if !t.reportedUnresolved[reportKey] {
+			t.reportedUnresolved[reportKey] = true
 
-			t.updateImagesFromInformer()
-		},
-	})
+			logrus.WithFields(logrus.Fields{
+				"image":  image,
+				"object": key,
+				"source": t.sourceName,
+			}).Warn("could not resolve parameters in image, skipping")
+		}
+	}
+
+	return images
+}
+
+// forgetObject drops the references and reported images of a deleted object.  Must be called with
+// the lock held.
+func (t *ArgoTemplateSource) forgetObject(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+
+	if err != nil {
+		return
+	}
+
+	t.setObjectRefs(key, nil)
+
+	for reportKey := range t.reportedUnresolved {
+		if strings.HasPrefix(reportKey, key+"/") {
+			delete(t.reportedUnresolved, reportKey)
+		}
+	}
+}
+
+// handleReferencedTemplateChange recomputes the images of every object that references the template
+// identified by key.
+func (t *ArgoTemplateSource) handleReferencedTemplateChange(key string) {
+	t.lock.RLock()
+	hasDependents := len(t.dependents[key]) > 0
+	t.lock.RUnlock()
+
+	if hasDependents {
+		t.resync()
+	}
+}
+
+func (t *ArgoTemplateSource) Run(ctx context.Context) {
+	if t.resolver != nil {
+		t.resolver.AddEventHandler(t.handleReferencedTemplateChange)
+	}
 
-	t.informer.Run(ctx.Done())
-	close(t.imageCh)
+	t.InformerSource.Run(ctx)
 }
@@ -0,0 +1,114 @@
+package source
+
+import (
+	"regexp"
+	"strings"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+)
+
+// maxSubstitutionDepth bounds how many times parameter values that themselves contain parameter
+// references (such as an input default of "{{workflow.parameters.image}}") are expanded.
+const maxSubstitutionDepth = 5
+
+var templateTagRegex = regexp.MustCompile(`{{(.*?)}}`)
+
+// parameterValues returns every value a parameter may take, which includes its default, its value
+// and all of its enum values.
+func parameterValues(parameter argov1alpha1.Parameter) []string {
+	var values []string
+	seen := make(map[string]bool)
+
+	add := func(value string) {
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+
+	if parameter.Value != nil {
+		add(parameter.Value.String())
+	}
+
+	if parameter.Default != nil {
+		add(parameter.Default.String())
+	}
+
+	for _, e := range parameter.Enum {
+		add(e.String())
+	}
+
+	return values
+}
+
+func addParameterValues(lookup map[string][]string, prefix string, parameters []argov1alpha1.Parameter) {
+	for _, p := range parameters {
+		key := prefix + p.Name
+		lookup[key] = append(lookup[key], parameterValues(p)...)
+	}
+}
+
+// newParameterLookup maps "workflow.parameters.<name>" and "inputs.parameters.<name>" references to
+// every value that they may take.
+func newParameterLookup(workflowParameters []argov1alpha1.Parameter, tmpl *argov1alpha1.Template) map[string][]string {
+	lookup := make(map[string][]string)
+
+	addParameterValues(lookup, "workflow.parameters.", workflowParameters)
+	addParameterValues(lookup, "inputs.parameters.", tmpl.Inputs.Parameters)
+
+	return lookup
+}
+
+// substituteParameters expands every parameter reference in value, returning one result for every
+// combination of parameter values.  Both simple tags ({{inputs.parameters.image}}) and expression
+// tags that consist of a single reference ({{=inputs.parameters.image}}) are supported.  If any
+// reference cannot be resolved, ok is false.
+func substituteParameters(value string, lookup map[string][]string, depth int) (results []string, ok bool) {
+	loc := templateTagRegex.FindStringSubmatchIndex(value)
+
+	if loc == nil {
+		return []string{value}, true
+	}
+
+	if depth >= maxSubstitutionDepth {
+		return nil, false
+	}
+
+	reference := strings.TrimSpace(value[loc[2]:loc[3]])
+	reference = strings.TrimSpace(strings.TrimPrefix(reference, "="))
+
+	candidates, exists := lookup[reference]
+
+	if !exists || len(candidates) == 0 {
+		return nil, false
+	}
+
+	suffixes, ok := substituteParameters(value[loc[1]:], lookup, depth)
+
+	if !ok {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+
+	for _, candidate := range candidates {
+		expanded, ok := substituteParameters(candidate, lookup, depth+1)
+
+		if !ok {
+			continue
+		}
+
+		for _, e := range expanded {
+			for _, suffix := range suffixes {
+				result := value[:loc[0]] + e + suffix
+
+				if !seen[result] {
+					seen[result] = true
+					results = append(results, result)
+				}
+			}
+		}
+	}
+
+	return results, len(results) > 0
+}
@@ -0,0 +1,78 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+var argoCDApplicationResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+// getImagesFromArgoCDApplicationFn returns the images that Argo CD reports in status.summary.images for
+// Applications that belong to one of projects, or to any project if projects is empty.
+func getImagesFromArgoCDApplicationFn(projects []string) func(obj interface{}) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+
+	for _, project := range projects {
+		allowed[project] = true
+	}
+
+	return func(obj interface{}) (map[string]bool, error) {
+		app, ok := obj.(*unstructured.Unstructured)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+		}
+
+		imageMap := make(map[string]bool)
+
+		if len(allowed) > 0 {
+			project, _, _ := unstructured.NestedString(app.Object, "spec", "project")
+
+			// Applications without a project belong to the default project
+			if project == "" {
+				project = "default"
+			}
+
+			if !allowed[project] {
+				return imageMap, nil
+			}
+		}
+
+		images, _, err := unstructured.NestedStringSlice(app.Object, "status", "summary", "images")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read status.summary.images of application %s/%s: %v", app.GetNamespace(), app.GetName(), err)
+		}
+
+		for _, image := range images {
+			if image != "" {
+				imageMap[image] = true
+			}
+		}
+
+		return imageMap, nil
+	}
+}
+
+// NewArgoCDApplicationSource creates a source that emits the images of Argo CD Applications matching
+// selector, as summarized by Argo CD.  If projects is not empty, only Applications in those projects
+// are considered.
+func NewArgoCDApplicationSource(client dynamic.Interface, resyncPeriod time.Duration, selector string, projects []string) ImageSource {
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "ArgoCDApplication",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			})
+
+			return newImageInformers(getImagesFromArgoCDApplicationFn(projects), fac.ForResource(argoCDApplicationResource).Informer())
+		},
+		resyncPeriod: resyncPeriod,
+	})
+}
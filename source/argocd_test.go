@@ -0,0 +1,149 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+var applicationResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+func argoCDApplication(name, project string, labels map[string]string, images ...string) *unstructured.Unstructured {
+	summaryImages := make([]interface{}, 0, len(images))
+
+	for _, image := range images {
+		summaryImages = append(summaryImages, image)
+	}
+
+	app := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Application",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "argocd",
+			},
+			"spec": map[string]interface{}{
+				"project": project,
+			},
+			"status": map[string]interface{}{
+				"summary": map[string]interface{}{
+					"images": summaryImages,
+				},
+			},
+		},
+	}
+
+	app.SetLabels(labels)
+
+	return app
+}
+
+func newFakeArgoCDClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		applicationResource: "ApplicationList",
+	}, objects...)
+}
+
+func Test_ArgoCDApplicationSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeArgoCDClient(
+		argoCDApplication("guestbook", "default", nil, "gcr.io/heptio-images/ks-guestbook-demo:0.2"),
+		argoCDApplication("monitoring", "platform", nil, "prom/prometheus:v2.30.0", "grafana/grafana:8.2.0"),
+		argoCDApplication("pending", "default", nil),
+	)
+
+	src := source.NewArgoCDApplicationSource(fakeClient, time.Minute*15, "", nil)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"gcr.io/heptio-images/ks-guestbook-demo:0.2", "prom/prometheus:v2.30.0", "grafana/grafana:8.2.0"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"gcr.io/heptio-images/ks-guestbook-demo:0.2", "prom/prometheus:v2.30.0", "grafana/grafana:8.2.0"})
+}
+
+func Test_ArgoCDApplicationSource_Projects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeArgoCDClient(
+		argoCDApplication("guestbook", "", nil, "guestbook:v1"),
+		argoCDApplication("monitoring", "platform", nil, "prom/prometheus:v2.30.0"),
+		argoCDApplication("sandbox", "experiments", nil, "sandbox:latest"),
+	)
+
+	src := source.NewArgoCDApplicationSource(fakeClient, time.Minute*15, "", []string{"default", "platform"})
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"guestbook:v1", "prom/prometheus:v2.30.0"})
+}
+
+func Test_ArgoCDApplicationSource_Selector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeArgoCDClient(
+		argoCDApplication("guestbook", "default", map[string]string{"cache": "true"}, "guestbook:v1"),
+		argoCDApplication("monitoring", "default", nil, "prom/prometheus:v2.30.0"),
+	)
+
+	src := source.NewArgoCDApplicationSource(fakeClient, time.Minute*15, "cache=true", nil)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"guestbook:v1"})
+}
+
+func Test_ArgoCDApplicationSource_Sync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeArgoCDClient(argoCDApplication("guestbook", "default", nil, "guestbook:v1", "redis:6"))
+
+	src := source.NewArgoCDApplicationSource(fakeClient, time.Minute*15, "", nil)
+
+	go src.Run(ctx)
+
+	argoCDSource := src.(*source.InformerSource)
+
+	for !argoCDSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_, err := fakeClient.Resource(applicationResource).Namespace("argocd").Update(ctx, argoCDApplication("guestbook", "default", nil, "guestbook:v2", "redis:6"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"guestbook:v1", "redis:6", "guestbook:v2"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"guestbook:v2", "redis:6"})
+}
+
+func Test_ArgoCDApplicationSource_Name(t *testing.T) {
+	src := source.NewArgoCDApplicationSource(newFakeArgoCDClient(), time.Minute*15, "", nil)
+
+	assert.Equal(t, "ArgoCDApplication", src.Name())
+}
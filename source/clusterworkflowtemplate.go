@@ -8,10 +8,10 @@ import (
 	argoinformers "github.com/argoproj/argo-workflows/v3/pkg/client/informers/externalversions"
 )
 
-func NewClusterWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration) ImageSource {
+func NewClusterWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration, optFns ...ArgoOptFn) ImageSource {
 	fac := argoinformers.NewSharedInformerFactory(client, resyncPeriod)
 
-	return NewArgoTemplateSource(&ArgoTemplateSourceOpts{
+	opts := &ArgoTemplateSourceOpts{
 		sourceName:   "ClusterWorkflowTemplate",
 		informer:     fac.Argoproj().V1alpha1().ClusterWorkflowTemplates().Informer(),
 		client:       client,
@@ -20,5 +20,15 @@ func NewClusterWorkflowTemplateSource(client argoclientset.Interface, resyncPeri
 			tmpl := obj.(*argov1alpha1.ClusterWorkflowTemplate)
 			return tmpl.Spec.WorkflowSpec.Templates
 		},
-	})
+		extractArgumentsFromObject: func(obj interface{}) argov1alpha1.Arguments {
+			tmpl := obj.(*argov1alpha1.ClusterWorkflowTemplate)
+			return tmpl.Spec.WorkflowSpec.Arguments
+		},
+	}
+
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return NewArgoTemplateSource(opts)
 }
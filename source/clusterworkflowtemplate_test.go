@@ -42,14 +42,10 @@ func Test_ClusterWorkflowTemplateSource_Containers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -96,14 +92,10 @@ func Test_ClusterWorkflowTemplateSource_Modify(t *testing.T) {
 	_, err := fakeClient.ArgoprojV1alpha1().ClusterWorkflowTemplates().Update(ctx, &workflowTemplate, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"ubuntu", "debian"})
 }
 
@@ -148,14 +140,10 @@ func Test_ClusterWorkflowTemplateSource_Delete(t *testing.T) {
 	err := fakeClient.ArgoprojV1alpha1().ClusterWorkflowTemplates().Delete(ctx, "test", metav1.DeleteOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{})
 }
 
@@ -192,14 +180,10 @@ func Test_ClusterWorkflowTemplateSource_Scripts(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -236,14 +220,10 @@ func Test_ClusterWorkflowTemplateSource_InitContainers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -253,3 +233,184 @@ func Test_ClusterWorkflowTemplateSource_Name(t *testing.T) {
 
 	assert.Equal(t, "ClusterWorkflowTemplate", src.Name())
 }
+
+func Test_ClusterWorkflowTemplateSource_Sidecars(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.ClusterWorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Sidecars: []argov1alpha1.UserContainer{
+							{
+								Container: v1.Container{
+									Image: "alpine",
+								},
+							},
+						},
+						Container: &v1.Container{
+							Image: "debian",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewClusterWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_ClusterWorkflowTemplateSource_Inline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.ClusterWorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Steps: []argov1alpha1.ParallelSteps{
+							{
+								Steps: []argov1alpha1.WorkflowStep{
+									{
+										Inline: &argov1alpha1.Template{
+											Container: &v1.Container{
+												Image: "alpine",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					{
+						DAG: &argov1alpha1.DAGTemplate{
+							Tasks: []argov1alpha1.DAGTask{
+								{
+									Inline: &argov1alpha1.Template{
+										Script: &argov1alpha1.ScriptTemplate{
+											Container: v1.Container{
+												Image: "debian",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewClusterWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_ClusterWorkflowTemplateSource_Resources(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.ClusterWorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  generateName: pod-
+spec:
+  containers:
+  - name: main
+    image: alpine
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: job-
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: debian
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "apply",
+							Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: main
+        image: ubuntu
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: configmap
+data:
+  image: centos
+`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewClusterWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "busybox", "ubuntu"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian", "busybox", "ubuntu"})
+}
@@ -3,6 +3,7 @@ package source
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -13,7 +14,8 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
-	"sigs.k8s.io/yaml"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const defaultImagesKey = "images"
@@ -33,201 +35,181 @@ func WithConfigMapSelector(selector string) OptFn {
 	}
 }
 
-func getImagesFromConfigMap(obj interface{}) (map[string]bool, error) {
+// imagesKeyFromAnnotations returns the data key that holds the list of images
+func imagesKeyFromAnnotations(annotations map[string]string) string {
+	if value, ok := annotations[imagesKeyAnnotation]; ok {
+		return value
+	}
+
+	return defaultImagesKey
+}
+
+// getImagesFromConfigMap records the options of the images of each ConfigMap.  Must be called with the
+// lock held, since it resyncs the images whose options changed.
+func (cms *ConfigMapSource) getImagesFromConfigMap(obj interface{}) (map[string]bool, error) {
 	cm, ok := obj.(*corev1.ConfigMap)
 
 	if !ok {
 		return nil, fmt.Errorf("could not cast input to corev1.ConfigMap")
 	}
 
-	imagesKey := defaultImagesKey
+	key, err := cache.MetaNamespaceKeyFunc(cm)
 
-	if value, ok := cm.Annotations[imagesKeyAnnotation]; ok {
-		imagesKey = value
+	if err != nil {
+		return nil, err
 	}
 
-	imageMap := make(map[string]bool)
-
-	if imagesStr, ok := cm.Data[imagesKey]; ok {
-		var images []string
+	if cms.reports != nil {
+		cms.reports.Add(key)
+	}
 
-		if err := yaml.Unmarshal([]byte(imagesStr), &images); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal key %s in configmap %s/%s: %v", imagesKey, cm.Namespace, cm.Name, err)
-		}
+	imagesKey := imagesKeyFromAnnotations(cm.Annotations)
+	imagesStr, ok := cm.Data[imagesKey]
 
-		for _, i := range images {
-			imageMap[i] = true
-		}
+	if !ok {
+		cms.setOptions(key, nil)
+		return make(map[string]bool), nil
 	}
 
-	return imageMap, nil
-}
+	options, err := parseImageEntries(imagesStr)
 
-type ConfigMapSource struct {
-	configmapSelector string
-	logger            *logrus.Logger
-	client            kubernetes.Interface
-	imageCh           chan string
-	imageMap          map[string]bool
-	informer          cache.SharedIndexInformer
-	images            []string
-	resyncPeriod      time.Duration
-	lock              sync.RWMutex
-}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key %s in configmap %s/%s: %v", imagesKey, cm.Namespace, cm.Name, err)
+	}
 
-func (cms *ConfigMapSource) ImageCh() <-chan string {
-	return cms.imageCh
-}
+	// An edit that only changes the options of images that are already held changes no images, so
+	// those images are resynced for the new options to be read
+	for _, image := range cms.setOptions(key, options) {
+		if cms.imageMap[image] {
+			cms.events <- ImageEvent{Type: ImageResync, Image: image, Source: cms.sourceName, Object: key}
+		}
+	}
 
-func (cms *ConfigMapSource) Images() []string {
-	cms.lock.RLock()
-	defer cms.lock.RUnlock()
+	imageMap := make(map[string]bool)
 
-	return cms.images
-}
+	for image := range options {
+		imageMap[image] = true
+	}
 
-func (*ConfigMapSource) Name() string {
-	return "ConfigMap"
+	return imageMap, nil
 }
 
-func (cms *ConfigMapSource) updateImagesFromInformer() {
-	cms.imageMap = cms.getImagesFromInformer()
+// setOptions records the options of the images of the ConfigMap with key, or drops them if options
+// is nil, and returns the images that the ConfigMap lists both before and after with different options
+func (cms *ConfigMapSource) setOptions(key string, options map[string][]ImageOptions) []string {
+	cms.optionsLock.Lock()
+	defer cms.optionsLock.Unlock()
 
-	var images []string
+	var changed []string
 
-	for key := range cms.imageMap {
-		images = append(images, key)
+	for image, previous := range cms.options[key] {
+		if current, ok := options[image]; ok && !reflect.DeepEqual(previous, current) {
+			changed = append(changed, image)
+		}
 	}
 
-	cms.images = images
-}
-
-func (cms *ConfigMapSource) getImagesFromInformer() map[string]bool {
-	imageMap := make(map[string]bool)
-
-	if cms.informer != nil {
-		indexer := cms.informer.GetIndexer()
-
-		for _, key := range indexer.ListKeys() {
-			value, exists, err := indexer.GetByKey(key)
+	if options == nil {
+		delete(cms.options, key)
+	} else {
+		cms.options[key] = options
+	}
 
-			if !exists {
-				logrus.Warnf("key %s did not exist in indexer", key)
-			} else if err != nil {
-				logrus.Errorf("failed to retrieve key %s from indexer: %v", key, err)
-			} else {
-				images, err := getImagesFromConfigMap(value)
+	return changed
+}
 
-				if err != nil {
-					cms.logger.Errorf("failed to get images from configmap: %v", err)
-					continue
-				}
+// forgetConfigMap drops the options of a deleted ConfigMap, and the parse result reported for it
+func (cms *ConfigMapSource) forgetConfigMap(obj interface{}) {
+	if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+		cms.setOptions(key, nil)
 
-				for image := range images {
-					imageMap[image] = true
-				}
-			}
+		if cms.reports != nil {
+			cms.reports.Add(key)
 		}
 	}
-
-	return imageMap
 }
 
-func (cms *ConfigMapSource) Run(ctx context.Context) {
-	cms.informer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			imageMap, err := getImagesFromConfigMap(obj)
-
-			if err != nil {
-				cms.logger.Errorf("failed to get images from configmap: %v", err)
-				return
-			}
-
-			cms.lock.Lock()
-			defer cms.lock.Unlock()
-
-			for key := range imageMap {
-				if _, exists := cms.imageMap[key]; !exists {
-					cms.imageMap[key] = true
-					cms.images = append(cms.images, key)
-					cms.imageCh <- key
-				}
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			currentImages, err := getImagesFromConfigMap(newObj)
-
-			if err != nil {
-				cms.logger.Errorf("failed to get images from configmap: %v", err)
-				return
-			}
-
-			previousImages, err := getImagesFromConfigMap(oldObj)
-
-			if err != nil {
-				cms.logger.Errorf("failed to get images from configmap: %v", err)
-				cms.logger.Warn("skipping deletion detection, could not parse prior images from configmap")
-				previousImages = currentImages
-			}
-
-			deletedImages := setDifference(previousImages, currentImages)
+// ImageOptions returns the options that image was listed with in every ConfigMap.  It may be called
+// while events are being received, so it never waits for the lock of the source, which is held while
+// events are sent.
+func (cms *ConfigMapSource) ImageOptions(image string) []ImageOptions {
+	cms.optionsLock.RLock()
+	defer cms.optionsLock.RUnlock()
 
-			cms.lock.Lock()
-			defer cms.lock.Unlock()
+	var options []ImageOptions
 
-			newImages := setDifference(currentImages, cms.imageMap)
-
-			for _, image := range newImages {
-				cms.imageMap[image] = true
-				cms.images = append(cms.images, image)
-				cms.imageCh <- image
-			}
+	for _, cmOptions := range cms.options {
+		options = append(options, cmOptions[image]...)
+	}
 
-			if len(deletedImages) > 0 {
-				cms.updateImagesFromInformer()
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			cms.lock.Lock()
-			defer cms.lock.Unlock()
+	return options
+}
 
-			cms.updateImagesFromInformer()
-		},
-	}, cms.resyncPeriod)
+// ConfigMapSource emits the images listed in every ConfigMap matching its selector
+type ConfigMapSource struct {
+	*InformerSource
 
-	cms.informer.Run(ctx.Done())
+	configmapSelector string
+	logger            *logrus.Logger
+	client            kubernetes.Interface
 
-	close(cms.imageCh)
+	// options holds the options of the images of each ConfigMap by key, and is guarded by optionsLock
+	options     map[string]map[string][]ImageOptions
+	optionsLock sync.RWMutex
+
+	// reports holds the keys of ConfigMaps whose parse result should be reported through recorder or
+	// the LastErrorAnnotation
+	recorder        record.EventRecorder
+	annotateErrors  bool
+	reportNamespace string
+	reportIdentity  string
+	reports         workqueue.RateLimitingInterface
+
+	// reported holds the last error reported for each ConfigMap by key, which is empty once its images
+	// were accepted, and is guarded by reportedLock
+	reported     map[string]string
+	reportedLock sync.Mutex
 }
 
-func (cms *ConfigMapSource) HasSynced() bool {
-	if cms.informer != nil {
-		return cms.informer.HasSynced()
+func (cms *ConfigMapSource) Run(ctx context.Context) {
+	if cms.reports != nil {
+		go cms.runReports(ctx)
 	}
 
-	return false
+	cms.InformerSource.Run(ctx)
 }
 
 func NewConfigMapSource(client kubernetes.Interface, resyncPeriod time.Duration, opts ...OptFn) ImageSource {
 	cms := &ConfigMapSource{
-		imageCh:      make(chan string),
-		imageMap:     make(map[string]bool),
-		images:       make([]string, 0),
-		client:       client,
-		logger:       logrus.StandardLogger(),
-		lock:         sync.RWMutex{},
-		resyncPeriod: resyncPeriod,
+		client:   client,
+		logger:   logrus.StandardLogger(),
+		options:  make(map[string]map[string][]ImageOptions),
+		reported: make(map[string]string),
 	}
 
 	for _, fn := range opts {
 		fn(cms)
 	}
 
-	fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithTweakListOptions(func(lo *v1.ListOptions) {
-		lo.LabelSelector = fields.ParseSelectorOrDie(cms.configmapSelector).String()
-	}))
+	if cms.recorder != nil || cms.annotateErrors {
+		cms.reports = newReportQueue()
+	}
+
+	selector := fields.ParseSelectorOrDie(cms.configmapSelector).String()
+
+	cms.InformerSource = NewInformerSource(&InformerSourceOpts{
+		sourceName: "ConfigMap",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			}))
+
+			return newImageInformers(cms.getImagesFromConfigMap, fac.Core().V1().ConfigMaps().Informer())
+		},
+		resyncPeriod: resyncPeriod,
+		logger:       cms.logger,
+	})
 
-	cms.informer = fac.Core().V1().ConfigMaps().Informer()
+	cms.onDelete = cms.forgetConfigMap
 
 	return cms
 }
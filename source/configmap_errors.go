@@ -0,0 +1,227 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// LastErrorAnnotation is set on a ConfigMap whose images could not be parsed, and removed once
+// they parse again
+const LastErrorAnnotation = "image-cache-daemon/last-error"
+
+const (
+	invalidImagesReason  = "InvalidImages"
+	imagesAcceptedReason = "ImagesAccepted"
+)
+
+// configMapReportsLease is the Lease held by the daemon that reports the parse results of ConfigMaps
+const configMapReportsLease = "image-cache-daemon-configmap-reports"
+
+// WithConfigMapEventRecorder reports ConfigMaps whose images cannot be parsed to their authors.  A
+// Warning Event is recorded on the ConfigMap when its images stop parsing, and a Normal Event once
+// they parse again.
+func WithConfigMapEventRecorder(recorder record.EventRecorder) OptFn {
+	return func(cms *ConfigMapSource) {
+		cms.recorder = recorder
+	}
+}
+
+// WithConfigMapLastErrorAnnotation writes the error of a ConfigMap whose images cannot be parsed to its
+// LastErrorAnnotation, which requires permission to update ConfigMaps
+func WithConfigMapLastErrorAnnotation() OptFn {
+	return func(cms *ConfigMapSource) {
+		cms.annotateErrors = true
+	}
+}
+
+// WithConfigMapReportElection only reports parse results from the daemon that is elected through a
+// Lease in daemonNamespace, so that a change is reported once rather than by every daemon.
+func WithConfigMapReportElection(daemonNamespace, identity string) OptFn {
+	return func(cms *ConfigMapSource) {
+		cms.reportNamespace = daemonNamespace
+		cms.reportIdentity = identity
+	}
+}
+
+// parseConfigMapImages returns the number of images listed by cm, or an error describing why they
+// could not be parsed
+func parseConfigMapImages(cm *corev1.ConfigMap) (int, error) {
+	imagesKey := imagesKeyFromAnnotations(cm.Annotations)
+	imagesStr, ok := cm.Data[imagesKey]
+
+	if !ok {
+		return 0, nil
+	}
+
+	options, err := parseImageEntries(imagesStr)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal key %s: %v", imagesKey, err)
+	}
+
+	return len(options), nil
+}
+
+// configMapFromCache returns the ConfigMap with key from the informer of its namespace
+func (cms *ConfigMapSource) configMapFromCache(key string) (*corev1.ConfigMap, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ii := range cms.scoped.forNamespace(namespace) {
+		value, exists, err := ii.informer.GetIndexer().GetByKey(key)
+
+		if err != nil || !exists {
+			return nil, err
+		}
+
+		if cm, ok := value.(*corev1.ConfigMap); ok {
+			return cm, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// reportParseResult reports the parse result of the ConfigMap with key when it differs from the last
+// one reported.  The Event is recorded before the annotation is written, so that an annotation which
+// cannot be written never hides it.
+func (cms *ConfigMapSource) reportParseResult(ctx context.Context, key string) error {
+	cm, err := cms.configMapFromCache(key)
+
+	if err != nil {
+		return err
+	}
+
+	cms.reportedLock.Lock()
+	defer cms.reportedLock.Unlock()
+
+	if cm == nil {
+		delete(cms.reported, key)
+		return nil
+	}
+
+	count, parseErr := parseConfigMapImages(cm)
+
+	lastError := ""
+
+	if parseErr != nil {
+		lastError = parseErr.Error()
+	}
+
+	previous, ok := cms.reported[key]
+
+	// A daemon that has not reported the ConfigMap yet continues from the annotation when it is written
+	if !ok && cms.annotateErrors {
+		previous = cm.Annotations[LastErrorAnnotation]
+	}
+
+	if lastError != previous && cms.recorder != nil {
+		if parseErr != nil {
+			cms.recorder.Eventf(cm, corev1.EventTypeWarning, invalidImagesReason, "Images could not be parsed: %v", parseErr)
+		} else {
+			cms.recorder.Eventf(cm, corev1.EventTypeNormal, imagesAcceptedReason, "Accepted %d images", count)
+		}
+	}
+
+	cms.reported[key] = lastError
+
+	if cms.annotateErrors {
+		return cms.annotateLastError(ctx, cm, lastError)
+	}
+
+	return nil
+}
+
+// annotateLastError sets the LastErrorAnnotation of cm to lastError, or removes it if lastError is empty
+func (cms *ConfigMapSource) annotateLastError(ctx context.Context, cm *corev1.ConfigMap, lastError string) error {
+	current, ok := cm.Annotations[LastErrorAnnotation]
+
+	if current == lastError && ok == (lastError != "") {
+		return nil
+	}
+
+	updated := cm.DeepCopy()
+
+	if lastError == "" {
+		delete(updated.Annotations, LastErrorAnnotation)
+	} else {
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+
+		updated.Annotations[LastErrorAnnotation] = lastError
+	}
+
+	_, err := cms.client.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, updated, v1.UpdateOptions{})
+
+	// The ConfigMap changed, and is reported again once the change is observed
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to set the %s annotation: %v", LastErrorAnnotation, err)
+	}
+
+	return nil
+}
+
+// processNextReport reports the next queued ConfigMap for as long as ctx is not done.  A report taken
+// from the queue after ctx is done is queued again for the next daemon that is elected.
+func (cms *ConfigMapSource) processNextReport(ctx context.Context) bool {
+	item, shutdown := cms.reports.Get()
+
+	if shutdown {
+		return false
+	}
+
+	defer cms.reports.Done(item)
+
+	if ctx.Err() != nil {
+		cms.reports.Add(item)
+		return false
+	}
+
+	if err := cms.reportParseResult(ctx, item.(string)); err != nil {
+		cms.logger.Errorf("failed to report the parse result of configmap %s: %v", item, err)
+		cms.reports.AddRateLimited(item)
+		return true
+	}
+
+	cms.reports.Forget(item)
+
+	return true
+}
+
+func (cms *ConfigMapSource) processReports(ctx context.Context) {
+	for cms.processNextReport(ctx) {
+	}
+}
+
+func (cms *ConfigMapSource) runReports(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		cms.reports.ShutDown()
+	}()
+
+	if cms.reportIdentity == "" {
+		cms.processReports(ctx)
+		return
+	}
+
+	runElected(ctx, cms.client, cms.reportNamespace, configMapReportsLease, cms.reportIdentity, "report the parse results of configmaps", cms.processReports)
+}
+func newReportQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Minute*5))
+}
@@ -3,13 +3,21 @@ package source_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/dcherman/image-cache-daemon/source"
 	"github.com/sirupsen/logrus"
@@ -59,14 +67,10 @@ func Test_ConfigMapSource_Defaults(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Modify(t *testing.T) {
@@ -102,15 +106,11 @@ func Test_ConfigMapSource_Modify(t *testing.T) {
 	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, &participatingConfigMap, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
 	assert.ElementsMatch(t, []string{"debian", "ubuntu"}, src.Images())
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Modify_Bad_Into_Good(t *testing.T) {
@@ -146,15 +146,11 @@ func Test_ConfigMapSource_Modify_Bad_Into_Good(t *testing.T) {
 	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, &participatingConfigMap, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"ubuntu", "debian"})
 	assert.ElementsMatch(t, []string{"ubuntu", "debian"}, src.Images())
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Modify_Good_Into_Bad(t *testing.T) {
@@ -190,15 +186,11 @@ func Test_ConfigMapSource_Modify_Good_Into_Bad(t *testing.T) {
 	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, &participatingConfigMap, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"ubuntu", "debian"})
 	assert.ElementsMatch(t, []string{"ubuntu", "debian"}, src.Images())
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Delete(t *testing.T) {
@@ -233,15 +225,94 @@ func Test_ConfigMapSource_Delete(t *testing.T) {
 	err := fakeClient.CoreV1().ConfigMaps("default").Delete(ctx, "configmap-1", metav1.DeleteOptions{})
 	assert.NoError(t, err)
 
-	var received []string
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, []string{}, src.Images())
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_ConfigMapSource_RemovedEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
 
-	for image := range src.ImageCh() {
-		received = append(received, image)
+	participatingConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "configmap-1",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "image-cache-daemon",
+			},
+		},
+		Data: map[string]string{
+			"images": marshalOrPanic([]string{"alpine", "debian"}),
+		},
 	}
 
-	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	fakeClient := fake.NewSimpleClientset(&participatingConfigMap)
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := []source.ImageEvent{<-src.Events(), <-src.Events()}
+
+	assert.ElementsMatch(t, received, []source.ImageEvent{
+		{Type: source.ImageAdded, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"},
+		{Type: source.ImageAdded, Image: "debian", Source: src.Name(), Object: "default/configmap-1"},
+	})
+
+	participatingConfigMap.Data["images"] = marshalOrPanic([]string{"debian"})
+	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, &participatingConfigMap, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, source.ImageEvent{Type: source.ImageRemoved, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"}, <-src.Events())
+
+	err = fakeClient.CoreV1().ConfigMaps("default").Delete(ctx, "configmap-1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []source.ImageEvent{
+		{Type: source.ImageRemoved, Image: "debian", Source: src.Name(), Object: "default/configmap-1"},
+	}, imageEvents(src))
 	assert.ElementsMatch(t, []string{}, src.Images())
-	assert.Len(t, src.ImageCh(), 0)
+}
+
+func Test_ConfigMapSource_Resync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+
+	t.Cleanup(cancel)
+
+	participatingConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "configmap-1",
+			Namespace:       "default",
+			ResourceVersion: "1",
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "image-cache-daemon",
+			},
+		},
+		Data: map[string]string{
+			"images": marshalOrPanic([]string{"alpine"}),
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&participatingConfigMap)
+	src := source.NewConfigMapSource(fakeClient, time.Second, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := imageEvents(src)
+
+	// The image is added once, and then pulled again whenever the informer resyncs
+	if assert.GreaterOrEqual(t, len(received), 2) {
+		assert.Equal(t, source.ImageEvent{Type: source.ImageAdded, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"}, received[0])
+
+		for _, event := range received[1:] {
+			assert.Equal(t, source.ImageEvent{Type: source.ImageResync, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"}, event)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"alpine"}, src.Images())
 }
 
 func Test_ConfigMapSource_AlternateKey(t *testing.T) {
@@ -271,14 +342,10 @@ func Test_ConfigMapSource_AlternateKey(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"ubuntu", "centos"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Bad_Input(t *testing.T) {
@@ -305,16 +372,12 @@ func Test_ConfigMapSource_Bad_Input(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
 
 	assert.Len(t, received, 0)
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 }
 
 func Test_ConfigMapSource_Name(t *testing.T) {
@@ -322,3 +385,347 @@ func Test_ConfigMapSource_Name(t *testing.T) {
 	src := source.NewConfigMapSource(fakeClient, time.Minute*15)
 	assert.Equal(t, "ConfigMap", src.Name())
 }
+
+func Test_ConfigMapSource_ImageOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	richConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "configmap-1",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "image-cache-daemon",
+			},
+		},
+		Data: map[string]string{
+			"images": `
+- alpine
+- image: cuda
+  nodeSelector:
+    gpu: "true"
+  priority: 10
+  pullPolicy: if-not-present
+  platforms:
+    - linux/amd64
+  expiresAt: "2030-01-02T03:04:05Z"
+`,
+		},
+	}
+
+	otherConfigMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "configmap-2",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "image-cache-daemon",
+			},
+		},
+		Data: map[string]string{
+			"images": `[{"image": "alpine", "priority": 5}]`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&richConfigMap, &otherConfigMap)
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "cuda"})
+
+	optionsSource := src.(source.ImageOptionsSource)
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, []source.ImageOptions{
+		{
+			NodeSelector: map[string]string{"gpu": "true"},
+			Priority:     10,
+			PullPolicy:   source.PullIfNotPresent,
+			Platforms:    []string{"linux/amd64"},
+			ExpiresAt:    &expiresAt,
+		},
+	}, optionsSource.ImageOptions("cuda"))
+
+	// A plain string contributes the zero value
+	assert.ElementsMatch(t, []source.ImageOptions{{}, {Priority: 5}}, optionsSource.ImageOptions("alpine"))
+	assert.Empty(t, optionsSource.ImageOptions("debian"))
+}
+
+func Test_ConfigMapSource_ImageOptions_Changed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "configmap-1",
+			Namespace: "default",
+		},
+		Data: map[string]string{
+			"images": `[{"image": "alpine", "priority": 1}, "debian"]`,
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&configMap)
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15)
+	optionsSource := src.(source.ImageOptionsSource)
+
+	go src.Run(ctx)
+
+	received := []source.ImageEvent{<-src.Events(), <-src.Events()}
+
+	assert.ElementsMatch(t, []source.ImageEvent{
+		{Type: source.ImageAdded, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"},
+		{Type: source.ImageAdded, Image: "debian", Source: src.Name(), Object: "default/configmap-1"},
+	}, received)
+
+	// Only the options of an image change, which resyncs that image so that its new options are read
+	configMap.Data["images"] = `[{"image": "alpine", "priority": 5, "nodeSelector": {"gpu": "true"}}, "debian"]`
+	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, &configMap, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, source.ImageEvent{Type: source.ImageResync, Image: "alpine", Source: src.Name(), Object: "default/configmap-1"}, <-src.Events())
+	assert.Equal(t, []source.ImageOptions{{Priority: 5, NodeSelector: map[string]string{"gpu": "true"}}}, optionsSource.ImageOptions("alpine"))
+
+	assert.Empty(t, imageEvents(src))
+	assert.ElementsMatch(t, []string{"alpine", "debian"}, src.Images())
+}
+
+// Options are resolved as each event is received, like the puller does, while the source is still
+// emitting the remaining images of the ConfigMap
+func Test_ConfigMapSource_ImageOptions_WhileEmitting(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	configMap := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "configmap-1",
+			Namespace: "default",
+		},
+		Data: map[string]string{
+			"images": marshalOrPanic([]string{"a:1", "b:1", "c:1"}),
+		},
+	}
+
+	src := source.NewConfigMapSource(fake.NewSimpleClientset(&configMap), time.Minute*15)
+	optionsSource := src.(source.ImageOptionsSource)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	for len(received) < 3 {
+		select {
+		case event := <-src.Events():
+			assert.Equal(t, []source.ImageOptions{{}}, optionsSource.ImageOptions(event.Image))
+			received = append(received, event.Image)
+		case <-ctx.Done():
+			t.Fatalf("received %v before timing out", received)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"a:1", "b:1", "c:1"}, received)
+}
+
+func Test_ConfigMapSource_Invalid_Entries(t *testing.T) {
+	for _, images := range []string{
+		`[{"priority": 1}]`,
+		`[{"image": "alpine", "pullPolicy": "never"}]`,
+		`[{"image": "alpine", "platforms": ["amd64"]}]`,
+		`[{"image": "alpine", "expiresAt": "tomorrow"}]`,
+		`[1]`,
+	} {
+		t.Run(images, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+			t.Cleanup(cancel)
+
+			logger, hook := test.NewNullLogger()
+
+			configMap := imageListConfigMap("default", "configmap-1")
+			configMap.Data["images"] = images
+
+			fakeClient := fake.NewSimpleClientset(configMap)
+			src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithLogger(logger), source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+			go src.Run(ctx)
+
+			received := addedImages(src)
+
+			assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+			assert.Len(t, received, 0)
+		})
+	}
+}
+
+// enforceConfigMapResourceVersions makes updates of ConfigMaps with a stale resourceVersion conflict,
+// which the fake clientset does not do on its own
+func enforceConfigMapResourceVersions(client *fake.Clientset) {
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updated := action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap)
+
+		current, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("configmaps"), updated.Namespace, updated.Name)
+
+		if err != nil {
+			return true, nil, err
+		}
+
+		if current.(*corev1.ConfigMap).ResourceVersion != updated.ResourceVersion {
+			return true, nil, errors.NewConflict(corev1.Resource("configmaps"), updated.Name, fmt.Errorf("stale resourceVersion"))
+		}
+
+		version, _ := strconv.Atoi(updated.ResourceVersion)
+		updated = updated.DeepCopy()
+		updated.ResourceVersion = strconv.Itoa(version + 1)
+
+		return true, updated, client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("configmaps"), updated, updated.Namespace)
+	})
+}
+
+func receiveEvent(t *testing.T, ctx context.Context, recorders ...*record.FakeRecorder) string {
+	for {
+		for _, recorder := range recorders {
+			select {
+			case event := <-recorder.Events:
+				return event
+			default:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("no event was recorded")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func Test_ConfigMapSource_Events(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	logger, _ := test.NewNullLogger()
+
+	configMap := imageListConfigMap("default", "configmap-1")
+	configMap.ResourceVersion = "1"
+	configMap.Data["images"] = "]["
+
+	fakeClient := fake.NewSimpleClientset(configMap)
+	enforceConfigMapResourceVersions(fakeClient)
+
+	// Every replica of the daemon observes the same ConfigMap
+	var recorders []*record.FakeRecorder
+
+	for i := 0; i < 3; i++ {
+		recorder := record.NewFakeRecorder(10)
+		recorders = append(recorders, recorder)
+
+		src := source.NewConfigMapSource(fakeClient, time.Minute*15,
+			source.WithLogger(logger),
+			source.WithConfigMapEventRecorder(recorder),
+			source.WithConfigMapLastErrorAnnotation(),
+			source.WithConfigMapReportElection("image-cache-daemon", fmt.Sprintf("daemon-%d", i)),
+			source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"),
+		)
+
+		go src.Run(ctx)
+	}
+
+	assert.Contains(t, receiveEvent(t, ctx, recorders...), "Warning InvalidImages Images could not be parsed: failed to unmarshal key images")
+
+	var current *corev1.ConfigMap
+
+	assert.Eventually(t, func() bool {
+		var err error
+		current, err = fakeClient.CoreV1().ConfigMaps("default").Get(ctx, "configmap-1", metav1.GetOptions{})
+		return err == nil && current.Annotations[source.LastErrorAnnotation] != ""
+	}, time.Millisecond*500, time.Millisecond*10)
+
+	assert.Contains(t, current.Annotations[source.LastErrorAnnotation], "failed to unmarshal key images")
+
+	current.Data["images"] = marshalOrPanic([]string{"alpine", "debian"})
+
+	_, err := fakeClient.CoreV1().ConfigMaps("default").Update(ctx, current, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Normal ImagesAccepted Accepted 2 images", receiveEvent(t, ctx, recorders...))
+
+	<-ctx.Done()
+
+	// Only the elected replica reported each change
+	for _, recorder := range recorders {
+		assert.Len(t, recorder.Events, 0)
+	}
+
+	current, err = fakeClient.CoreV1().ConfigMaps("default").Get(context.Background(), "configmap-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, current.Annotations, source.LastErrorAnnotation)
+}
+
+func Test_ConfigMapSource_Events_WithoutAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		annotate bool
+	}{
+		{
+			name: "annotation disabled",
+		},
+		{
+			name:     "annotation that cannot be written",
+			annotate: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+			t.Cleanup(cancel)
+
+			logger, hook := test.NewNullLogger()
+
+			configMap := imageListConfigMap("default", "configmap-1")
+			configMap.Data["images"] = "]["
+
+			fakeClient := fake.NewSimpleClientset(configMap)
+
+			var updates int32
+
+			fakeClient.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				atomic.AddInt32(&updates, 1)
+				return true, nil, errors.NewForbidden(corev1.Resource("configmaps"), "configmap-1", fmt.Errorf("not allowed"))
+			})
+
+			recorder := record.NewFakeRecorder(10)
+
+			opts := []source.OptFn{source.WithLogger(logger), source.WithConfigMapEventRecorder(recorder), source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon")}
+
+			if tc.annotate {
+				opts = append(opts, source.WithConfigMapLastErrorAnnotation())
+			}
+
+			go source.NewConfigMapSource(fakeClient, time.Minute*15, opts...).Run(ctx)
+
+			assert.Contains(t, receiveEvent(t, ctx, recorder), "Warning InvalidImages Images could not be parsed")
+
+			<-ctx.Done()
+
+			assert.Len(t, recorder.Events, 0)
+
+			if !tc.annotate {
+				assert.Zero(t, atomic.LoadInt32(&updates))
+				return
+			}
+
+			// The failed update is logged rather than dropped
+			assert.NotZero(t, atomic.LoadInt32(&updates))
+
+			var logged bool
+
+			for _, entry := range hook.AllEntries() {
+				if strings.Contains(entry.Message, "failed to report the parse result of configmap default/configmap-1") {
+					logged = true
+				}
+			}
+
+			assert.True(t, logged)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/robfig/cron/v3"
+)
+
+// cronRecomputeInterval is how often sources with a CronWindow recompute their images, which is
+// the granularity of cron schedules
+const cronRecomputeInterval = time.Minute
+
+// CronWindow restricts the images of scheduled objects, such as CronWorkflows and CronJobs, to the
+// time around each of their runs so that they are not kept on the node in between.
+type CronWindow struct {
+	// Lead is how long before a run its images are pulled
+	Lead time.Duration
+	// Grace is how long after a run is scheduled its images are kept, which covers the time until
+	// the run is reported as active
+	Grace time.Duration
+
+	clock clock.Clock
+}
+
+func NewCronWindow(lead, grace time.Duration) *CronWindow {
+	return &CronWindow{
+		Lead:  lead,
+		Grace: grace,
+		clock: clock.New(),
+	}
+}
+
+// contains returns whether an object with schedule, which may be prefixed with CRON_TZ=<timezone>,
+// needs its images now.  Objects with active runs always need them.
+func (w *CronWindow) contains(schedule string, active bool) (bool, error) {
+	parsed, err := cron.ParseStandard(schedule)
+
+	if err != nil {
+		return false, err
+	}
+
+	if active {
+		return true, nil
+	}
+
+	// A run within (now - grace, now + lead] is either about to start or has just started
+	now := w.clock.Now()
+
+	return !parsed.Next(now.Add(-w.Grace)).After(now.Add(w.Lead)), nil
+}
@@ -0,0 +1,326 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	argofake "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newMockCronWindow returns a window whose clock is set to the given time of 2021-06-01 UTC
+func newMockCronWindow(lead, grace time.Duration, hour, minute int) (*CronWindow, *clock.Mock) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Date(2021, 6, 1, hour, minute, 0, 0, time.UTC))
+
+	window := NewCronWindow(lead, grace)
+	window.clock = mockClock
+
+	return window, mockClock
+}
+
+func scheduledCronWorkflow(name, schedule, timezone string, suspend bool, image string) *argov1alpha1.CronWorkflow {
+	return &argov1alpha1.CronWorkflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.CronWorkflowSpec{
+			Schedule: schedule,
+			Timezone: timezone,
+			Suspend:  suspend,
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Container: &corev1.Container{
+							Image: image,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// receiveImages collects the images emitted by src by the type of their events until none have been
+// emitted for a short while
+func receiveImages(src ImageSource) map[ImageEventType][]string {
+	received := make(map[ImageEventType][]string)
+
+	for {
+		select {
+		case event := <-src.Events():
+			received[event.Type] = append(received[event.Type], event.Image)
+		case <-time.After(time.Millisecond * 100):
+			return received
+		}
+	}
+}
+
+func Test_CronWindow(t *testing.T) {
+	window, mockClock := newMockCronWindow(time.Hour, time.Minute*10, 1, 30)
+
+	contains := func(schedule string, active bool) bool {
+		due, err := window.contains(schedule, active)
+		assert.NoError(t, err)
+		return due
+	}
+
+	assert.False(t, contains("0 3 * * *", false))
+	assert.True(t, contains("0 3 * * *", true))
+
+	mockClock.Set(time.Date(2021, 6, 1, 2, 0, 0, 0, time.UTC))
+	assert.True(t, contains("0 3 * * *", false))
+
+	mockClock.Set(time.Date(2021, 6, 1, 3, 5, 0, 0, time.UTC))
+	assert.True(t, contains("0 3 * * *", false))
+
+	mockClock.Set(time.Date(2021, 6, 1, 3, 10, 0, 0, time.UTC))
+	assert.False(t, contains("0 3 * * *", false))
+
+	// 03:00 in Tokyo is 18:00 UTC
+	mockClock.Set(time.Date(2021, 6, 1, 17, 30, 0, 0, time.UTC))
+	assert.True(t, contains("CRON_TZ=Asia/Tokyo 0 3 * * *", false))
+	assert.False(t, contains("0 3 * * *", false))
+
+	_, err := window.contains("whenever", false)
+	assert.Error(t, err)
+}
+
+func Test_CronWorkflowSource_CronWindow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+
+	t.Cleanup(cancel)
+
+	window, mockClock := newMockCronWindow(time.Hour, time.Minute*10, 1, 30)
+
+	fakeClient := argofake.NewSimpleClientset(
+		scheduledCronWorkflow("early", "0 2 * * *", "", false, "alpine"),
+		scheduledCronWorkflow("late", "0 3 * * *", "", false, "debian"),
+		// 04:00 in Berlin is 02:00 UTC
+		scheduledCronWorkflow("berlin", "0 4 * * *", "Europe/Berlin", false, "ubuntu"),
+		scheduledCronWorkflow("suspended", "0 2 * * *", "", true, "busybox"),
+	)
+
+	src := NewCronWorkflowTemplateSource(fakeClient, time.Minute*15, WithCronWindow(window))
+
+	go src.Run(ctx)
+
+	assert.ElementsMatch(t, []string{"alpine", "ubuntu"}, receiveImages(src)[ImageAdded])
+
+	// The window of the 03:00 run opens, while the runs at 02:00 are over
+	mockClock.Add(time.Minute * 90)
+
+	received := receiveImages(src)
+	assert.ElementsMatch(t, []string{"debian"}, received[ImageAdded])
+	assert.ElementsMatch(t, []string{"alpine", "ubuntu"}, received[ImageRemoved])
+	assert.ElementsMatch(t, []string{"debian"}, src.Images())
+
+	// After the 03:00 run, nothing is kept until the window of the next run opens
+	mockClock.Add(time.Minute * 15)
+
+	received = receiveImages(src)
+	assert.Empty(t, received[ImageAdded])
+	assert.ElementsMatch(t, []string{"debian"}, received[ImageRemoved])
+	assert.Empty(t, src.Images())
+}
+
+func Test_CronWorkflowSource_Suspended(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := argofake.NewSimpleClientset(
+		scheduledCronWorkflow("active", "0 2 * * *", "", false, "alpine"),
+		scheduledCronWorkflow("suspended", "0 2 * * *", "", true, "busybox"),
+	)
+
+	src := NewCronWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	for event := range src.Events() {
+		received = append(received, event.Image)
+	}
+
+	assert.ElementsMatch(t, []string{"alpine"}, received)
+}
+
+func Test_JobSource_CronWindow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+
+	t.Cleanup(cancel)
+
+	window, _ := newMockCronWindow(time.Hour, time.Minute*10, 1, 30)
+
+	cronJob := func(name, schedule string, active bool, image string) *batchv1.CronJob {
+		cj := &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: schedule,
+				JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{{Image: image}},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		if active {
+			cj.Status.Active = []corev1.ObjectReference{{Name: name + "-1"}}
+		}
+
+		return cj
+	}
+
+	fakeClient := fake.NewSimpleClientset(
+		cronJob("soon", "0 2 * * *", false, "alpine"),
+		cronJob("later", "0 12 * * *", false, "debian"),
+		// A run that outlasts the grace period keeps its images while it is active
+		cronJob("running", "0 0 * * *", true, "ubuntu"),
+		cronJob("tokyo", "CRON_TZ=Asia/Tokyo 0 11 * * *", false, "busybox"),
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "job",
+				Namespace: "default",
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Image: "nginx"}},
+					},
+				},
+			},
+		},
+	)
+
+	src := NewJobSource(fakeClient, time.Minute*15, "", true, window)
+
+	go src.Run(ctx)
+
+	// 11:00 in Tokyo is 02:00 UTC, and Jobs are never restricted
+	assert.ElementsMatch(t, []string{"alpine", "ubuntu", "busybox", "nginx"}, receiveImages(src)[ImageAdded])
+}
+
+func Test_JobSource_CronWindow_OnlyRecomputesCronJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+	t.Cleanup(cancel)
+
+	window, mockClock := newMockCronWindow(time.Minute*5, time.Minute*5, 1, 45)
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cronjob",
+			Namespace: "default",
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "0 2 * * *",
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Image: "debian"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "default",
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Image: "nginx"}},
+				},
+			},
+		},
+	}
+
+	src := NewJobSource(fake.NewSimpleClientset(cronJob, job), time.Minute*15, "", true, window).(*InformerSource)
+
+	// Count the number of times that the Job is extracted
+	var lock sync.Mutex
+	jobExtractions := 0
+
+	namespacedInformers := src.namespacedInformers
+	src.namespacedInformers = func(namespace string) []imageInformer {
+		iis := namespacedInformers(namespace)
+		extractImagesFromObject := iis[0].extractImagesFromObject
+
+		iis[0].extractImagesFromObject = func(obj interface{}) (map[string]bool, error) {
+			lock.Lock()
+			jobExtractions++
+			lock.Unlock()
+
+			return extractImagesFromObject(obj)
+		}
+
+		return iis
+	}
+
+	extractions := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return jobExtractions
+	}
+
+	// advance moves the clock forward a minute at a time, so that every check observes its own minute,
+	// and returns the images emitted along the way
+	advance := func(minutes int) map[ImageEventType][]string {
+		received := make(map[ImageEventType][]string)
+
+		for i := 0; i < minutes; i++ {
+			mockClock.Add(time.Minute)
+
+			for eventType, images := range receiveImages(src) {
+				received[eventType] = append(received[eventType], images...)
+			}
+		}
+
+		return received
+	}
+
+	go src.Run(ctx)
+
+	assert.ElementsMatch(t, []string{"nginx"}, receiveImages(src)[ImageAdded])
+
+	// The first check establishes whether each CronJob is due, which recomputes every object once
+	assert.Empty(t, advance(1))
+	baseline := extractions()
+
+	// Minutes pass without the window of the CronJob opening, which opens at 01:55
+	assert.Empty(t, advance(8))
+	assert.Equal(t, baseline, extractions())
+
+	// Opening the window only extracts the CronJob
+	assert.Equal(t, map[ImageEventType][]string{ImageAdded: {"debian"}}, advance(1))
+	assert.Equal(t, baseline, extractions())
+
+	// Closing the window at 02:05 withdraws its images like any other removal
+	assert.Equal(t, map[ImageEventType][]string{ImageRemoved: {"debian"}}, advance(10))
+	assert.ElementsMatch(t, []string{"nginx"}, src.Images())
+}
@@ -1,24 +1,64 @@
 package source
 
 import (
+	"fmt"
 	"time"
 
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	argoclientset "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	argoinformers "github.com/argoproj/argo-workflows/v3/pkg/client/informers/externalversions"
+	"k8s.io/client-go/tools/cache"
 )
 
-func NewCronWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration) ImageSource {
-	fac := argoinformers.NewSharedInformerFactory(client, resyncPeriod)
-
-	return NewArgoTemplateSource(&ArgoTemplateSourceOpts{
+// NewCronWorkflowTemplateSource creates a source that emits the images of every CronWorkflow that is
+// not suspended.  With WithCronWindow, the images are only emitted around each run.
+func NewCronWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration, optFns ...ArgoOptFn) ImageSource {
+	opts := &ArgoTemplateSourceOpts{
 		sourceName: "CronWorkflow",
-		informer:   fac.Argoproj().V1alpha1().CronWorkflows().Informer(),
+		namespacedInformer: func(namespace string) cache.SharedIndexInformer {
+			fac := argoinformers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, argoinformers.WithNamespace(namespace))
+			return fac.Argoproj().V1alpha1().CronWorkflows().Informer()
+		},
 		extractTemplatesFromObject: func(obj interface{}) []argov1alpha1.Template {
 			tmpl := obj.(*argov1alpha1.CronWorkflow)
 			return tmpl.Spec.WorkflowSpec.Templates
 		},
+		extractArgumentsFromObject: func(obj interface{}) argov1alpha1.Arguments {
+			tmpl := obj.(*argov1alpha1.CronWorkflow)
+			return tmpl.Spec.WorkflowSpec.Arguments
+		},
+		extractWorkflowTemplateRefFromObject: func(obj interface{}) *argov1alpha1.WorkflowTemplateRef {
+			tmpl := obj.(*argov1alpha1.CronWorkflow)
+			return tmpl.Spec.WorkflowSpec.WorkflowTemplateRef
+		},
 		client:       client,
 		resyncPeriod: resyncPeriod,
-	})
+	}
+
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	opts.includeObject = func(obj interface{}) (bool, error) {
+		cronWorkflow := obj.(*argov1alpha1.CronWorkflow)
+
+		// Suspended CronWorkflows never run
+		if cronWorkflow.Spec.Suspend {
+			return false, nil
+		}
+
+		if opts.cronWindow == nil {
+			return true, nil
+		}
+
+		due, err := opts.cronWindow.contains(cronWorkflow.Spec.GetScheduleString(), len(cronWorkflow.Status.Active) > 0)
+
+		if err != nil {
+			return false, fmt.Errorf("invalid schedule of cron workflow %s/%s: %v", cronWorkflow.Namespace, cronWorkflow.Name, err)
+		}
+
+		return due, nil
+	}
+
+	return NewArgoTemplateSource(opts)
 }
@@ -42,14 +42,10 @@ func Test_CronWorkflowSource_Containers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -96,14 +92,10 @@ func Test_CronWorkflowSource_Modify(t *testing.T) {
 	_, err := fakeClient.ArgoprojV1alpha1().CronWorkflows("default").Update(ctx, &cronWorkflow, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"ubuntu", "debian"})
 }
 
@@ -149,14 +141,10 @@ func Test_CronWorkflowSource_Delete(t *testing.T) {
 	err := fakeClient.ArgoprojV1alpha1().CronWorkflows("default").Delete(ctx, "test", metav1.DeleteOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{})
 }
 
@@ -193,14 +181,10 @@ func Test_CronWorkflowSource_Scripts(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -237,14 +221,10 @@ func Test_CronWorkflowSource_InitContainers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -254,3 +234,184 @@ func Test_CronWorkflowSource_Name(t *testing.T) {
 
 	assert.Equal(t, "CronWorkflow", src.Name())
 }
+
+func Test_CronWorkflowSource_Sidecars(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Sidecars: []argov1alpha1.UserContainer{
+							{
+								Container: v1.Container{
+									Image: "alpine",
+								},
+							},
+						},
+						Container: &v1.Container{
+							Image: "debian",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow)
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_CronWorkflowSource_Inline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Steps: []argov1alpha1.ParallelSteps{
+							{
+								Steps: []argov1alpha1.WorkflowStep{
+									{
+										Inline: &argov1alpha1.Template{
+											Container: &v1.Container{
+												Image: "alpine",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					{
+						DAG: &argov1alpha1.DAGTemplate{
+							Tasks: []argov1alpha1.DAGTask{
+								{
+									Inline: &argov1alpha1.Template{
+										Script: &argov1alpha1.ScriptTemplate{
+											Container: v1.Container{
+												Image: "debian",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow)
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_CronWorkflowSource_Resources(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronWorkflow := argov1alpha1.CronWorkflow{
+		Spec: argov1alpha1.CronWorkflowSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  generateName: pod-
+spec:
+  containers:
+  - name: main
+    image: alpine
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: job-
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: debian
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "apply",
+							Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: main
+        image: ubuntu
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: configmap
+data:
+  image: centos
+`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&cronWorkflow)
+	src := source.NewCronWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "busybox", "ubuntu"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian", "busybox", "ubuntu"})
+}
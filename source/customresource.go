@@ -0,0 +1,161 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// CustomResourceRule describes where images can be found in a resource
+type CustomResourceRule struct {
+	// Resource is the group, version and resource to watch
+	Resource schema.GroupVersionResource
+	// LabelSelector optionally restricts the objects that are watched
+	LabelSelector string
+	// Path is a JSONPath expression such as ".spec.steps[*].image".  The surrounding braces are optional.
+	Path string
+}
+
+// ParseCustomResourceRule parses a rule of the form "<group>/<version>/<resource>[?<selector>]: <path>"
+// such as "tekton.dev/v1/tasks: .spec.steps[*].image".  The group is omitted for core resources, as
+// in "v1/pods: .spec.containers[*].image".
+func ParseCustomResourceRule(rule string) (*CustomResourceRule, error) {
+	idx := strings.Index(rule, ":")
+
+	if idx == -1 {
+		return nil, fmt.Errorf("rule %q must be of the form <group>/<version>/<resource>[?<selector>]: <path>", rule)
+	}
+
+	resource, path := strings.TrimSpace(rule[:idx]), strings.TrimSpace(rule[idx+1:])
+
+	r := &CustomResourceRule{
+		Path: path,
+	}
+
+	if idx := strings.Index(resource, "?"); idx != -1 {
+		r.LabelSelector = resource[idx+1:]
+		resource = resource[:idx]
+
+		if _, err := labels.Parse(r.LabelSelector); err != nil {
+			return nil, fmt.Errorf("rule %q has an invalid label selector: %v", rule, err)
+		}
+	}
+
+	gvr, err := ParseGroupVersionResource(resource)
+
+	if err != nil {
+		return nil, fmt.Errorf("rule %q is invalid: %v", rule, err)
+	}
+
+	r.Resource = gvr
+
+	if _, err := parseImagePath(r.Path); err != nil {
+		return nil, fmt.Errorf("rule %q has an invalid path: %v", rule, err)
+	}
+
+	return r, nil
+}
+
+func parseImagePath(path string) (*jsonpath.JSONPath, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path must not be empty")
+	}
+
+	if !strings.HasPrefix(path, "{") {
+		path = fmt.Sprintf("{%s}", path)
+	}
+
+	jp := jsonpath.New("image").AllowMissingKeys(true)
+
+	if err := jp.Parse(path); err != nil {
+		return nil, err
+	}
+
+	return jp, nil
+}
+
+func getImagesFromUnstructuredFn(paths []*jsonpath.JSONPath) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+		}
+
+		imageMap := make(map[string]bool)
+
+		for _, jp := range paths {
+			results, err := jp.FindResults(u.Object)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate path against %s %s/%s: %v", u.GetKind(), u.GetNamespace(), u.GetName(), err)
+			}
+
+			for _, values := range results {
+				for _, value := range values {
+					if image, ok := value.Interface().(string); ok && image != "" {
+						imageMap[image] = true
+					}
+				}
+			}
+		}
+
+		return imageMap, nil
+	}
+}
+
+// NewCustomResourceSource creates a source that emits the images found by evaluating each rule against
+// the objects of its resource.  Rules that share a resource and label selector share an informer.
+func NewCustomResourceSource(client dynamic.Interface, resyncPeriod time.Duration, rules []CustomResourceRule) (ImageSource, error) {
+	type informerKey struct {
+		resource      schema.GroupVersionResource
+		labelSelector string
+	}
+
+	var keys []informerKey
+	paths := make(map[informerKey][]*jsonpath.JSONPath)
+
+	for _, rule := range rules {
+		jp, err := parseImagePath(rule.Path)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q for %s: %v", rule.Path, rule.Resource, err)
+		}
+
+		key := informerKey{resource: rule.Resource, labelSelector: rule.LabelSelector}
+
+		if _, ok := paths[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		paths[key] = append(paths[key], jp)
+	}
+
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "CustomResource",
+		namespacedInformers: func(namespace string) []imageInformer {
+			var iis []imageInformer
+
+			for _, key := range keys {
+				selector := key.labelSelector
+
+				fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, func(lo *v1.ListOptions) {
+					lo.LabelSelector = selector
+				})
+
+				iis = append(iis, newImageInformers(getImagesFromUnstructuredFn(paths[key]), fac.ForResource(key.resource).Informer())...)
+			}
+
+			return iis
+		},
+		resyncPeriod: resyncPeriod,
+	}), nil
+}
@@ -0,0 +1,219 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+var taskResource = schema.GroupVersionResource{Group: "tekton.dev", Version: "v1", Resource: "tasks"}
+
+func taskWithImages(name string, labels map[string]string, images ...string) *unstructured.Unstructured {
+	var steps []interface{}
+
+	for _, image := range images {
+		steps = append(steps, map[string]interface{}{
+			"name":  "step",
+			"image": image,
+		})
+	}
+
+	task := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "tekton.dev/v1",
+			"kind":       "Task",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"steps": steps,
+			},
+		},
+	}
+
+	task.SetLabels(labels)
+
+	return task
+}
+
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		taskResource: "TaskList",
+	}, objects...)
+}
+
+func Test_ParseCustomResourceRule(t *testing.T) {
+	rule, err := source.ParseCustomResourceRule("tekton.dev/v1/tasks: .spec.steps[*].image")
+	assert.NoError(t, err)
+	assert.Equal(t, &source.CustomResourceRule{Resource: taskResource, Path: ".spec.steps[*].image"}, rule)
+
+	rule, err = source.ParseCustomResourceRule("tekton.dev/v1/tasks?team=ml,tier!=test: {.spec.steps[*].image}")
+	assert.NoError(t, err)
+	assert.Equal(t, &source.CustomResourceRule{Resource: taskResource, LabelSelector: "team=ml,tier!=test", Path: "{.spec.steps[*].image}"}, rule)
+
+	rule, err = source.ParseCustomResourceRule("v1/pods: .spec.containers[*].image")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, rule.Resource)
+
+	for _, invalid := range []string{
+		"tekton.dev/v1/tasks",
+		"tasks: .spec.steps[*].image",
+		"tekton.dev/v1/tasks: ",
+		"tekton.dev/v1/tasks: .spec.steps[*.image",
+		"tekton.dev/v1/tasks?team=a b: .spec.steps[*].image",
+	} {
+		_, err := source.ParseCustomResourceRule(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func Test_CustomResourceSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeDynamicClient(
+		taskWithImages("build", nil, "golang", "alpine"),
+		taskWithImages("test", nil, "alpine", "debian"),
+	)
+
+	src, err := source.NewCustomResourceSource(fakeClient, time.Minute*15, []source.CustomResourceRule{
+		{Resource: taskResource, Path: ".spec.steps[*].image"},
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"golang", "alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"golang", "alpine", "debian"})
+}
+
+func Test_CustomResourceSource_LabelSelector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeDynamicClient(
+		taskWithImages("build", map[string]string{"team": "ml"}, "golang"),
+		taskWithImages("test", map[string]string{"team": "web"}, "node"),
+	)
+
+	src, err := source.NewCustomResourceSource(fakeClient, time.Minute*15, []source.CustomResourceRule{
+		{Resource: taskResource, LabelSelector: "team=ml", Path: ".spec.steps[*].image"},
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"golang"})
+}
+
+func Test_CustomResourceSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	task := taskWithImages("build", nil, "golang", "alpine")
+	fakeClient := newFakeDynamicClient(task)
+
+	src, err := source.NewCustomResourceSource(fakeClient, time.Minute*15, []source.CustomResourceRule{
+		{Resource: taskResource, Path: ".spec.steps[*].image"},
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	customResourceSource := src.(*source.InformerSource)
+
+	for !customResourceSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_, err = fakeClient.Resource(taskResource).Namespace("default").Update(ctx, taskWithImages("build", nil, "golang", "debian"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"golang", "alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"golang", "debian"})
+}
+
+func Test_CustomResourceSource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeDynamicClient(
+		taskWithImages("build", nil, "golang", "alpine"),
+		taskWithImages("test", nil, "alpine", "debian"),
+	)
+
+	src, err := source.NewCustomResourceSource(fakeClient, time.Minute*15, []source.CustomResourceRule{
+		{Resource: taskResource, Path: ".spec.steps[*].image"},
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	customResourceSource := src.(*source.InformerSource)
+
+	for !customResourceSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err = fakeClient.Resource(taskResource).Namespace("default").Delete(ctx, "test", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"golang", "alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"golang", "alpine"})
+}
+
+func Test_CustomResourceSource_MultiplePaths(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	task := taskWithImages("build", nil, "golang")
+	assert.NoError(t, unstructured.SetNestedSlice(task.Object, []interface{}{
+		map[string]interface{}{"name": "docker", "image": "docker:dind"},
+	}, "spec", "sidecars"))
+
+	fakeClient := newFakeDynamicClient(task)
+
+	src, err := source.NewCustomResourceSource(fakeClient, time.Minute*15, []source.CustomResourceRule{
+		{Resource: taskResource, Path: ".spec.steps[*].image"},
+		{Resource: taskResource, Path: ".spec.sidecars[*].image"},
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"golang", "docker:dind"})
+}
+
+func Test_CustomResourceSource_Name(t *testing.T) {
+	src, err := source.NewCustomResourceSource(newFakeDynamicClient(), time.Minute*15, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "CustomResource", src.Name())
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// runElected calls run for every term in which the daemon identified by identity holds the Lease
+// named leaseName in daemonNamespace, until ctx is done.  The context passed to run is cancelled as
+// soon as the Lease is lost.  duty describes what the elected daemon does, for logging.
+func runElected(ctx context.Context, kubeClient kubernetes.Interface, daemonNamespace, leaseName, identity, duty string, run func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: v1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: daemonNamespace,
+		},
+		Client: kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   time.Second * 15,
+			RenewDeadline:   time.Second * 10,
+			RetryPeriod:     time.Second * 2,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					logrus.Infof("elected to %s", duty)
+					run(leaderCtx)
+				},
+				OnStoppedLeading: func() {
+					logrus.Infof("no longer elected to %s", duty)
+				},
+			},
+		})
+	}
+}
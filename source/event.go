@@ -0,0 +1,100 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	pullingMessageRegex = regexp.MustCompile(`^Pulling image "(.+)"$`)
+	pulledMessageRegex  = regexp.MustCompile(`^Successfully pulled image "(.+)" in ([0-9.]+[a-zµ]+(?:[0-9.]+[a-zµ]+)*)`)
+	backOffMessageRegex = regexp.MustCompile(`^Back-off pulling image "(.+)"$`)
+)
+
+// getImageFromPullEvent returns the image that a kubelet image pull event refers to, if any.  When
+// minPullDuration is set, only completed pulls that took at least that long are considered.
+func getImageFromPullEvent(event *corev1.Event, minPullDuration time.Duration) (string, error) {
+	switch event.Reason {
+	case "Pulling":
+		if match := pullingMessageRegex.FindStringSubmatch(event.Message); match != nil && minPullDuration == 0 {
+			return match[1], nil
+		}
+	case "BackOff":
+		if match := backOffMessageRegex.FindStringSubmatch(event.Message); match != nil && minPullDuration == 0 {
+			return match[1], nil
+		}
+	case "Pulled":
+		// Images that were already present on the node also produce a Pulled event, which is ignored
+		match := pulledMessageRegex.FindStringSubmatch(event.Message)
+
+		if match == nil {
+			return "", nil
+		}
+
+		duration, err := time.ParseDuration(match[2])
+
+		if err != nil {
+			return "", fmt.Errorf("failed to parse pull duration of event %s/%s: %v", event.Namespace, event.Name, err)
+		}
+
+		if duration >= minPullDuration {
+			return match[1], nil
+		}
+	}
+
+	return "", nil
+}
+
+func getImagesFromEventFn(minPullDuration time.Duration, excludeNamespace string) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		event, ok := obj.(*corev1.Event)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to corev1.Event")
+		}
+
+		imageMap := make(map[string]bool)
+
+		if event.InvolvedObject.Kind != "Pod" || (excludeNamespace != "" && event.InvolvedObject.Namespace == excludeNamespace) {
+			return imageMap, nil
+		}
+
+		image, err := getImageFromPullEvent(event, minPullDuration)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if image != "" {
+			imageMap[image] = true
+		}
+
+		return imageMap, nil
+	}
+}
+
+// NewEventSource creates a source that emits the images that kubelet reports pulling for Pods anywhere in
+// the cluster, so that every other node pulls them ahead of time.  Images remain in the desired set for
+// as long as their events are retained by the API server.  If minPullDuration is set, only images whose
+// pull took at least that long are emitted.  Events for Pods in excludeNamespace, typically the
+// namespace of the cache daemon's own pull pods, are ignored.
+func NewEventSource(client kubernetes.Interface, resyncPeriod time.Duration, minPullDuration time.Duration, excludeNamespace string) ImageSource {
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "Event",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.FieldSelector = fields.OneTermEqualSelector("involvedObject.kind", "Pod").String()
+			}))
+
+			return newImageInformers(getImagesFromEventFn(minPullDuration, excludeNamespace), fac.Core().V1().Events().Informer())
+		},
+		resyncPeriod: resyncPeriod,
+	})
+}
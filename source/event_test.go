@@ -0,0 +1,135 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func podEvent(namespace, name, reason, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: namespace,
+			Name:      "pod-" + name,
+		},
+		Reason:  reason,
+		Message: message,
+		Type:    corev1.EventTypeNormal,
+	}
+}
+
+func Test_EventSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	notPod := podEvent("default", "event-5", "Pulling", `Pulling image "ignored"`)
+	notPod.InvolvedObject.Kind = "Node"
+
+	fakeClient := fake.NewSimpleClientset(
+		podEvent("default", "event-1", "Pulling", `Pulling image "nginx:1.21"`),
+		podEvent("default", "event-2", "Pulled", `Successfully pulled image "redis:6" in 2.345s`),
+		podEvent("default", "event-3", "BackOff", `Back-off pulling image "private.example.com/app:v1"`),
+		podEvent("default", "event-4", "Pulled", `Container image "alpine" already present on machine`),
+		podEvent("default", "event-6", "BackOff", `Back-off restarting failed container`),
+		notPod,
+	)
+
+	src := source.NewEventSource(fakeClient, time.Minute*15, 0, "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx:1.21", "redis:6", "private.example.com/app:v1"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"nginx:1.21", "redis:6", "private.example.com/app:v1"})
+}
+
+func Test_EventSource_MinPullDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		podEvent("default", "event-1", "Pulling", `Pulling image "nginx:1.21"`),
+		podEvent("default", "event-2", "Pulled", `Successfully pulled image "redis:6" in 2.345s`),
+		podEvent("default", "event-3", "Pulled", `Successfully pulled image "tensorflow/tensorflow:2.6.0-gpu" in 1m12.5s`),
+		podEvent("default", "event-4", "Pulled", `Successfully pulled image "pytorch/pytorch:1.9.0" in 41.2s (41.2s including waiting)`),
+		podEvent("default", "event-5", "Pulled", `Successfully pulled image "busybox" in 523ms`),
+	)
+
+	src := source.NewEventSource(fakeClient, time.Minute*15, time.Second*30, "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"tensorflow/tensorflow:2.6.0-gpu", "pytorch/pytorch:1.9.0"})
+}
+
+func Test_EventSource_ExcludeNamespace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		podEvent("default", "event-1", "Pulling", `Pulling image "nginx:1.21"`),
+		podEvent("image-cache-daemon", "event-2", "Pulling", `Pulling image "redis:6"`),
+	)
+
+	src := source.NewEventSource(fakeClient, time.Minute*15, 0, "image-cache-daemon")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx:1.21"})
+}
+
+func Test_EventSource_Expiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		podEvent("default", "event-1", "Pulling", `Pulling image "nginx:1.21"`),
+		podEvent("default", "event-2", "Pulling", `Pulling image "redis:6"`),
+	)
+
+	src := source.NewEventSource(fakeClient, time.Minute*15, 0, "")
+
+	go src.Run(ctx)
+
+	eventSource := src.(*source.InformerSource)
+
+	for !eventSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err := fakeClient.CoreV1().Events("default").Delete(ctx, "event-2", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx:1.21", "redis:6"})
+	assert.ElementsMatch(t, src.Images(), []string{"nginx:1.21"})
+}
+
+func Test_EventSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewEventSource(fakeClient, time.Minute*15, 0, "")
+	assert.Equal(t, "Event", src.Name())
+}
@@ -0,0 +1,260 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// parseImageFile parses either a JSON or YAML list of images, or a newline-delimited list of images
+// where blank lines and lines starting with # are ignored.  Files with a .json, .yaml or .yml extension
+// must contain a list.
+func parseImageFile(path string, data []byte) (map[string]bool, error) {
+	imageMap, err := parseImageList(string(data))
+
+	if err == nil {
+		return imageMap, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return nil, err
+	}
+
+	imageMap = make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		imageMap[line] = true
+	}
+
+	return imageMap, scanner.Err()
+}
+
+// FileSource emits the images listed in a set of files and directories, reloading them whenever they
+// change on disk.
+type FileSource struct {
+	paths  []string
+	logger *logrus.Logger
+	events chan ImageEvent
+
+	// fileImages holds the images most recently read from each file
+	fileImages map[string]map[string]bool
+	imageMap   map[string]bool
+	images     []string
+	lock       sync.RWMutex
+	synced     bool
+}
+
+// NewFileSource creates a source that reads images from each of paths.  A path may either be a file, or
+// a directory in which case every file directly inside of it is read; hidden files are skipped.
+func NewFileSource(paths []string) ImageSource {
+	return &FileSource{
+		paths:      paths,
+		logger:     logrus.StandardLogger(),
+		events:     make(chan ImageEvent),
+		fileImages: make(map[string]map[string]bool),
+		imageMap:   make(map[string]bool),
+		images:     make([]string, 0),
+	}
+}
+
+func (fs *FileSource) Events() <-chan ImageEvent {
+	return fs.events
+}
+
+func (fs *FileSource) Images() []string {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	return fs.images
+}
+
+func (*FileSource) Name() string {
+	return "File"
+}
+
+func (fs *FileSource) HasSynced() bool {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	return fs.synced
+}
+
+// listFiles returns every file that should currently be read
+func (fs *FileSource) listFiles() []string {
+	var files []string
+
+	for _, path := range fs.paths {
+		info, err := os.Stat(path)
+
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fs.logger.Errorf("failed to stat %s: %v", path, err)
+			}
+
+			continue
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+
+		if err != nil {
+			fs.logger.Errorf("failed to read directory %s: %v", path, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			file := filepath.Join(path, entry.Name())
+
+			// Entries are typically symlinks when the directory is a mounted ConfigMap
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files
+}
+
+// reload re-reads every file, keeping the previous images of any file that can no longer be parsed.
+// Must be called with the lock held.
+func (fs *FileSource) reload() {
+	fileImages := make(map[string]map[string]bool)
+
+	for _, file := range fs.listFiles() {
+		data, err := ioutil.ReadFile(file)
+
+		if err == nil {
+			fileImages[file], err = parseImageFile(file, data)
+		}
+
+		if err != nil {
+			fs.logger.Errorf("failed to get images from file %s: %v", file, err)
+
+			if previous, ok := fs.fileImages[file]; ok {
+				fs.logger.Warnf("skipping deletion detection, could not parse images from file %s", file)
+				fileImages[file] = previous
+			} else {
+				delete(fileImages, file)
+			}
+		}
+	}
+
+	fs.fileImages = fileImages
+
+	currentImages := make(map[string]bool)
+
+	for _, images := range fileImages {
+		for image := range images {
+			currentImages[image] = true
+		}
+	}
+
+	emitImageChanges(fs.events, fs.Name(), "", fs.imageMap, currentImages)
+
+	fs.imageMap = currentImages
+
+	var images []string
+
+	for image := range currentImages {
+		images = append(images, image)
+	}
+
+	fs.images = images
+}
+
+// watchDirectories returns the directories that need to be watched.  Both a path and its parent are
+// watched, since kubelet updates mounted ConfigMaps by atomically swapping a ..data symlink in the
+// mounted directory rather than writing to the files themselves.
+func (fs *FileSource) watchDirectories() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, path := range fs.paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			add(path)
+		}
+
+		add(filepath.Dir(path))
+	}
+
+	return dirs
+}
+
+func (fs *FileSource) Run(ctx context.Context) {
+	defer close(fs.events)
+
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		fs.logger.Errorf("failed to create file watcher: %v", err)
+		return
+	}
+
+	defer watcher.Close()
+
+	for _, dir := range fs.watchDirectories() {
+		if err := watcher.Add(dir); err != nil {
+			fs.logger.Errorf("failed to watch %s: %v", dir, err)
+		}
+	}
+
+	fs.lock.Lock()
+	fs.reload()
+	fs.synced = true
+	fs.lock.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			fs.lock.Lock()
+			fs.reload()
+			fs.lock.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			fs.logger.Errorf("error watching files: %v", err)
+		}
+	}
+}
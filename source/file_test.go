@@ -0,0 +1,173 @@
+package source_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func writeFileOrFail(t *testing.T, path, contents string) {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+}
+
+func waitForFileSource(src source.ImageSource) {
+	fileSource := src.(*source.FileSource)
+
+	for !fileSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func Test_FileSource_Formats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	dir := t.TempDir()
+
+	writeFileOrFail(t, filepath.Join(dir, "images.json"), `["alpine", "debian"]`)
+	writeFileOrFail(t, filepath.Join(dir, "images.yaml"), `
+- golang
+- alpine
+`)
+	writeFileOrFail(t, filepath.Join(dir, "images.txt"), `# base images
+busybox
+
+nginx:1.21
+`)
+
+	src := source.NewFileSource([]string{dir})
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "golang", "busybox", "nginx:1.21"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian", "golang", "busybox", "nginx:1.21"})
+}
+
+func Test_FileSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	file := filepath.Join(t.TempDir(), "images.yaml")
+	writeFileOrFail(t, file, `["alpine", "debian"]`)
+
+	src := source.NewFileSource([]string{file})
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+	waitForFileSource(src)
+
+	writeFileOrFail(t, file, `["alpine", "golang"]`)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "golang"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "golang"})
+}
+
+func Test_FileSource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	dir := t.TempDir()
+	writeFileOrFail(t, filepath.Join(dir, "a.txt"), "alpine\n")
+	writeFileOrFail(t, filepath.Join(dir, "b.txt"), "debian\n")
+
+	src := source.NewFileSource([]string{dir})
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+	waitForFileSource(src)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "b.txt")))
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine"})
+}
+
+func Test_FileSource_BadInput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "images.json")
+	writeFileOrFail(t, file, `["alpine", "debian"]`)
+
+	src := source.NewFileSource([]string{dir})
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+	waitForFileSource(src)
+
+	// The previous images are kept until the file can be parsed again
+	writeFileOrFail(t, file, `{"image": "golang"}`)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+// Test_FileSource_SymlinkSwap mimics the way kubelet atomically updates a mounted ConfigMap
+func Test_FileSource_SymlinkSwap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	dir := t.TempDir()
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..2021_01_01"), 0755))
+	writeFileOrFail(t, filepath.Join(dir, "..2021_01_01", "images"), `["alpine"]`)
+	assert.NoError(t, os.Symlink("..2021_01_01", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "images"), filepath.Join(dir, "images")))
+
+	src := source.NewFileSource([]string{filepath.Join(dir, "images")})
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image)
+	waitForFileSource(src)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..2021_01_02"), 0755))
+	writeFileOrFail(t, filepath.Join(dir, "..2021_01_02", "images"), `["debian"]`)
+	assert.NoError(t, os.Symlink("..2021_01_02", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "..2021_01_01")))
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"debian"})
+}
+
+func Test_FileSource_Name(t *testing.T) {
+	src := source.NewFileSource(nil)
+
+	assert.Equal(t, "File", src.Name())
+}
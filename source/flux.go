@@ -0,0 +1,111 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const fluxImagePolicyGroup = "image.toolkit.fluxcd.io"
+
+// FluxImagePolicySource emits the image that Flux image automation is about to deploy, as reported by
+// status.latestImage of each ImagePolicy, along with the image that it replaced so that rollbacks are
+// also cached.
+type FluxImagePolicySource struct {
+	*InformerSource
+
+	// previousImages holds the latestImage that each policy reported before its current one
+	previousImages map[string]string
+	latestImages   map[string]string
+}
+
+// getImagesFromImagePolicy must be called with the lock held, since it records the latest image of
+// each policy in order to remember the previous one.
+func (f *FluxImagePolicySource) getImagesFromImagePolicy(obj interface{}) (map[string]bool, error) {
+	policy, ok := obj.(*unstructured.Unstructured)
+
+	if !ok {
+		return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(policy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	imageMap := make(map[string]bool)
+
+	latestImage, _, err := unstructured.NestedString(policy.Object, "status", "latestImage")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status.latestImage of image policy %s: %v", key, err)
+	}
+
+	if latestImage == "" {
+		return imageMap, nil
+	}
+
+	if latest, ok := f.latestImages[key]; ok && latest != latestImage {
+		f.previousImages[key] = latest
+	}
+
+	f.latestImages[key] = latestImage
+	imageMap[latestImage] = true
+
+	// Newer versions of Flux report the previous image themselves, which survives restarts of the daemon
+	if previousImage, _, _ := unstructured.NestedString(policy.Object, "status", "observedPreviousImage"); previousImage != "" {
+		f.previousImages[key] = previousImage
+	}
+
+	if previousImage := f.previousImages[key]; previousImage != "" && previousImage != latestImage {
+		imageMap[previousImage] = true
+	}
+
+	return imageMap, nil
+}
+
+// forgetImagePolicy drops the image history of a deleted policy.  Must be called with the lock held.
+func (f *FluxImagePolicySource) forgetImagePolicy(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+
+	if err != nil {
+		return
+	}
+
+	delete(f.latestImages, key)
+	delete(f.previousImages, key)
+}
+
+// NewFluxImagePolicySource creates a source that emits the latest and previous images of every Flux
+// ImagePolicy matching selector.  version is the served version of the image.toolkit.fluxcd.io API.
+func NewFluxImagePolicySource(client dynamic.Interface, resyncPeriod time.Duration, version string, selector string) ImageSource {
+	resource := schema.GroupVersionResource{Group: fluxImagePolicyGroup, Version: version, Resource: "imagepolicies"}
+
+	f := &FluxImagePolicySource{
+		previousImages: make(map[string]string),
+		latestImages:   make(map[string]string),
+	}
+
+	f.InformerSource = NewInformerSource(&InformerSourceOpts{
+		sourceName: "FluxImagePolicy",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			})
+
+			return newImageInformers(f.getImagesFromImagePolicy, fac.ForResource(resource).Informer())
+		},
+		resyncPeriod: resyncPeriod,
+	})
+
+	f.onDelete = f.forgetImagePolicy
+
+	return f
+}
@@ -0,0 +1,182 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+var imagePolicyResource = schema.GroupVersionResource{Group: "image.toolkit.fluxcd.io", Version: "v1beta1", Resource: "imagepolicies"}
+
+func fluxImagePolicy(name string, labels map[string]string, latestImage string) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "image.toolkit.fluxcd.io/v1beta1",
+			"kind":       "ImagePolicy",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "flux-system",
+			},
+			"spec": map[string]interface{}{
+				"imageRepositoryRef": map[string]interface{}{
+					"name": name,
+				},
+			},
+			"status": map[string]interface{}{},
+		},
+	}
+
+	if latestImage != "" {
+		policy.Object["status"] = map[string]interface{}{
+			"latestImage": latestImage,
+		}
+	}
+
+	policy.SetLabels(labels)
+
+	return policy
+}
+
+func newFakeFluxClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		imagePolicyResource: "ImagePolicyList",
+	}, objects...)
+}
+
+func Test_FluxImagePolicySource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeFluxClient(
+		fluxImagePolicy("podinfo", nil, "ghcr.io/stefanprodan/podinfo:5.0.3"),
+		fluxImagePolicy("pending", nil, ""),
+	)
+
+	src := source.NewFluxImagePolicySource(fakeClient, time.Minute*15, "v1beta1", "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"ghcr.io/stefanprodan/podinfo:5.0.3"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"ghcr.io/stefanprodan/podinfo:5.0.3"})
+}
+
+func Test_FluxImagePolicySource_Selector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeFluxClient(
+		fluxImagePolicy("podinfo", map[string]string{"cache": "true"}, "podinfo:5.0.3"),
+		fluxImagePolicy("other", nil, "other:v1"),
+	)
+
+	src := source.NewFluxImagePolicySource(fakeClient, time.Minute*15, "v1beta1", "cache=true")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"podinfo:5.0.3"})
+}
+
+func Test_FluxImagePolicySource_KeepsPreviousImage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeFluxClient(fluxImagePolicy("podinfo", nil, "podinfo:5.0.1"))
+
+	src := source.NewFluxImagePolicySource(fakeClient, time.Minute*15, "v1beta1", "")
+
+	go src.Run(ctx)
+
+	fluxSource := src.(*source.FluxImagePolicySource)
+
+	for !fluxSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image)
+
+	_, err := fakeClient.Resource(imagePolicyResource).Namespace("flux-system").Update(ctx, fluxImagePolicy("podinfo", nil, "podinfo:5.0.2"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, (<-src.Events()).Image)
+
+	assert.ElementsMatch(t, src.Images(), []string{"podinfo:5.0.1", "podinfo:5.0.2"})
+
+	_, err = fakeClient.Resource(imagePolicyResource).Namespace("flux-system").Update(ctx, fluxImagePolicy("podinfo", nil, "podinfo:5.0.3"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"podinfo:5.0.1", "podinfo:5.0.2", "podinfo:5.0.3"})
+	assert.ElementsMatch(t, src.Images(), []string{"podinfo:5.0.2", "podinfo:5.0.3"})
+}
+
+func Test_FluxImagePolicySource_ObservedPreviousImage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	policy := fluxImagePolicy("podinfo", nil, "podinfo:5.0.2")
+
+	err := unstructured.SetNestedField(policy.Object, "podinfo:5.0.1", "status", "observedPreviousImage")
+	assert.NoError(t, err)
+
+	src := source.NewFluxImagePolicySource(newFakeFluxClient(policy), time.Minute*15, "v1beta1", "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"podinfo:5.0.1", "podinfo:5.0.2"})
+}
+
+func Test_FluxImagePolicySource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeFluxClient(
+		fluxImagePolicy("podinfo", nil, "podinfo:5.0.1"),
+		fluxImagePolicy("other", nil, "other:v1"),
+	)
+
+	src := source.NewFluxImagePolicySource(fakeClient, time.Minute*15, "v1beta1", "")
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	err := fakeClient.Resource(imagePolicyResource).Namespace("flux-system").Delete(ctx, "other", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"podinfo:5.0.1", "other:v1"})
+	assert.ElementsMatch(t, src.Images(), []string{"podinfo:5.0.1"})
+}
+
+func Test_FluxImagePolicySource_Name(t *testing.T) {
+	src := source.NewFluxImagePolicySource(newFakeFluxClient(), time.Minute*15, "v1beta1", "")
+
+	assert.Equal(t, "FluxImagePolicy", src.Name())
+}
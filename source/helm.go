@@ -0,0 +1,283 @@
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// helmReleaseSelector matches the Secrets that the Helm v3 storage driver keeps for deployed revisions
+const helmReleaseSelector = "owner=helm,status=deployed"
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+var manifestSeparatorRegex = regexp.MustCompile(`(?m)^---\s*$`)
+
+// helmRelease holds the fields of a Helm release that are needed to find its images
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Manifest  string `json:"manifest"`
+}
+
+// decodeHelmRelease decodes a release the same way as the Helm storage driver; the release is gzipped
+// JSON that is base64 encoded, in addition to the base64 encoding of the Secret itself.
+func decodeHelmRelease(data []byte) (*helmRelease, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode release: %v", err)
+	}
+
+	if bytes.HasPrefix(decoded, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(decoded))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress release: %v", err)
+		}
+
+		defer reader.Close()
+
+		decoded, err = ioutil.ReadAll(reader)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress release: %v", err)
+		}
+	}
+
+	release := &helmRelease{}
+
+	if err := json.Unmarshal(decoded, release); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal release: %v", err)
+	}
+
+	return release, nil
+}
+
+// getImagesFromHelmManifest returns the images of every pod spec in the rendered manifest of a release
+func getImagesFromHelmManifest(manifest string) map[string]bool {
+	imageMap := make(map[string]bool)
+
+	for _, document := range manifestSeparatorRegex.Split(manifest, -1) {
+		if strings.TrimSpace(stripYAMLComments(document)) == "" {
+			continue
+		}
+
+		images, err := getImagesFromManifest(document)
+
+		if err != nil {
+			logrus.Debugf("skipping manifest that could not be decoded: %v", err)
+			continue
+		}
+
+		for _, image := range images {
+			imageMap[image] = true
+		}
+	}
+
+	return imageMap
+}
+
+func stripYAMLComments(document string) string {
+	var lines []string
+
+	for _, line := range strings.Split(document, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func helmReleaseVersion(secret *corev1.Secret) int {
+	version, err := strconv.Atoi(secret.Labels["version"])
+
+	if err != nil {
+		return 0
+	}
+
+	return version
+}
+
+// helmReleaseIndex indexes release Secrets by the namespace and name of their release
+const helmReleaseIndex = "helmRelease"
+
+func helmReleaseKey(secret *corev1.Secret) string {
+	return secret.Namespace + "/" + secret.Labels["name"]
+}
+
+func indexByHelmRelease(obj interface{}) ([]string, error) {
+	secret, ok := obj.(*corev1.Secret)
+
+	if !ok {
+		return nil, fmt.Errorf("could not cast input to corev1.Secret")
+	}
+
+	return []string{helmReleaseKey(secret)}, nil
+}
+
+// helmReleaseImages holds the images decoded from the latest deployed revision of a release
+type helmReleaseImages struct {
+	secretKey string
+	data      []byte
+	images    map[string]bool
+}
+
+// HelmSource emits the images of the latest deployed revision of every Helm release.  The images of
+// each release are decoded once per revision, so that recomputing the images of every release only
+// decodes the releases that changed.
+type HelmSource struct {
+	*InformerSource
+
+	// releases holds the images of each release by the key of the release, and is guarded by the lock
+	releases map[string]*helmReleaseImages
+	// superseded is set once a release gains a newer deployed revision than the one in releases,
+	// whose images are then withdrawn by recomputing the images of every release
+	superseded bool
+}
+
+// getImagesFromHelmReleaseFn returns the images of a deployed release Secret, unless a later revision
+// of the same release is also deployed.  Helm marks the previous revision as superseded shortly after
+// an upgrade or rollback.  Must be called with the lock held.
+func (hs *HelmSource) getImagesFromHelmReleaseFn(indexer cache.Indexer) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		secret, ok := obj.(*corev1.Secret)
+
+		if !ok {
+			return nil, fmt.Errorf("could not cast input to corev1.Secret")
+		}
+
+		if secret.Labels["status"] != "deployed" {
+			return make(map[string]bool), nil
+		}
+
+		version := helmReleaseVersion(secret)
+		releaseKey := helmReleaseKey(secret)
+
+		revisions, err := indexer.ByIndex(helmReleaseIndex, releaseKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, revision := range revisions {
+			if o, ok := revision.(*corev1.Secret); ok && o.Labels["status"] == "deployed" && helmReleaseVersion(o) > version {
+				return make(map[string]bool), nil
+			}
+		}
+
+		secretKey, err := cache.MetaNamespaceKeyFunc(secret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, ok := secret.Data["release"]
+
+		if !ok {
+			return nil, fmt.Errorf("secret %s/%s has no release key", secret.Namespace, secret.Name)
+		}
+
+		cached, ok := hs.releases[releaseKey]
+
+		if ok && cached.secretKey == secretKey && bytes.Equal(cached.data, data) {
+			return cached.images, nil
+		}
+
+		release, err := decodeHelmRelease(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read helm release from secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+
+		if ok && cached.secretKey != secretKey {
+			hs.superseded = true
+		}
+
+		images := getImagesFromHelmManifest(release.Manifest)
+
+		hs.releases[releaseKey] = &helmReleaseImages{
+			secretKey: secretKey,
+			data:      data,
+			images:    images,
+		}
+
+		return images, nil
+	}
+}
+
+// onChange withdraws the images of a revision that was superseded by a newer deployed revision.
+// Must be called with the lock held.
+func (hs *HelmSource) onChange(obj interface{}) bool {
+	superseded := hs.superseded
+	hs.superseded = false
+
+	return superseded
+}
+
+// forgetHelmRelease drops the images of a release whose latest revision was deleted.  Must be called
+// with the lock held.
+func (hs *HelmSource) forgetHelmRelease(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	secret, ok := obj.(*corev1.Secret)
+
+	if !ok {
+		return
+	}
+
+	releaseKey := helmReleaseKey(secret)
+
+	if cached, ok := hs.releases[releaseKey]; ok && cached.secretKey == secret.Namespace+"/"+secret.Name {
+		delete(hs.releases, releaseKey)
+	}
+}
+
+// NewHelmSource creates a source that emits the images used by the latest deployed revision of every
+// Helm v3 release stored in Secrets.
+func NewHelmSource(client kubernetes.Interface, resyncPeriod time.Duration) ImageSource {
+	hs := &HelmSource{
+		releases: make(map[string]*helmReleaseImages),
+	}
+
+	hs.InformerSource = NewInformerSource(&InformerSourceOpts{
+		sourceName: "Helm",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.LabelSelector = helmReleaseSelector
+			}))
+
+			informer := fac.Core().V1().Secrets().Informer()
+
+			if err := informer.AddIndexers(cache.Indexers{helmReleaseIndex: indexByHelmRelease}); err != nil {
+				logrus.Errorf("failed to add the helm release index: %v", err)
+			}
+
+			return newImageInformers(hs.getImagesFromHelmReleaseFn(informer.GetIndexer()), informer)
+		},
+		resyncPeriod: resyncPeriod,
+		onChange:     hs.onChange,
+	})
+
+	hs.onDelete = hs.forgetHelmRelease
+
+	return hs
+}
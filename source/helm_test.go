@@ -0,0 +1,265 @@
+package source_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func helmManifest(images ...string) string {
+	manifest := `---
+# Source: app/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+`
+
+	for idx, image := range images {
+		manifest += fmt.Sprintf(`---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-%d
+spec:
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+        - name: main
+          image: %s
+`, idx, image)
+	}
+
+	return manifest + `---
+# Source: app/templates/crd.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: app
+spec:
+  image: should-be-ignored
+`
+}
+
+func helmReleaseSecret(name string, version int, status string, images ...string) *corev1.Secret {
+	release := marshalOrPanic(map[string]interface{}{
+		"name":      name,
+		"namespace": "default",
+		"version":   version,
+		"manifest":  helmManifest(images...),
+		"info": map[string]interface{}{
+			"status": status,
+		},
+	})
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write([]byte(release)); err != nil {
+		panic(err)
+	}
+
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, version),
+			Namespace: "default",
+			Labels: map[string]string{
+				"owner":   "helm",
+				"name":    name,
+				"status":  status,
+				"version": strconv.Itoa(version),
+			},
+		},
+		Type: "helm.sh/release.v1",
+		Data: map[string][]byte{
+			"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes())),
+		},
+	}
+}
+
+func Test_HelmSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		helmReleaseSecret("app", 1, "superseded", "app:v1"),
+		helmReleaseSecret("app", 2, "deployed", "app:v2", "redis:6"),
+		helmReleaseSecret("other", 1, "deployed", "other:v1"),
+		helmReleaseSecret("broken", 1, "failed", "broken:v1"),
+	)
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"app:v2", "redis:6", "other:v1"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"app:v2", "redis:6", "other:v1"})
+}
+
+func Test_HelmSource_LatestDeployedRevision(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	// Both revisions are briefly deployed during an upgrade
+	fakeClient := fake.NewSimpleClientset(
+		helmReleaseSecret("app", 1, "deployed", "app:v1"),
+		helmReleaseSecret("app", 2, "deployed", "app:v2"),
+	)
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	addedImages(src)
+
+	assert.NotContains(t, src.Images(), "app:v1")
+	assert.ElementsMatch(t, src.Images(), []string{"app:v2"})
+}
+
+func Test_HelmSource_Upgrade(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(helmReleaseSecret("app", 1, "deployed", "app:v1", "redis:6"))
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	_, err := fakeClient.CoreV1().Secrets("default").Create(ctx, helmReleaseSecret("app", 2, "deployed", "app:v2", "redis:6"), metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, err = fakeClient.CoreV1().Secrets("default").Update(ctx, helmReleaseSecret("app", 1, "superseded", "app:v1", "redis:6"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"app:v1", "redis:6", "app:v2"})
+	assert.ElementsMatch(t, src.Images(), []string{"app:v2", "redis:6"})
+}
+
+func Test_HelmSource_UpgradeBeforeSuperseded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(helmReleaseSecret("app", 1, "deployed", "app:v1", "redis:6"))
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	// The images of the previous revision are withdrawn as soon as a newer revision is deployed
+	_, err := fakeClient.CoreV1().Secrets("default").Create(ctx, helmReleaseSecret("app", 2, "deployed", "app:v2", "redis:6"), metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	events := imageEvents(src)
+
+	assert.Equal(t, []source.ImageEvent{
+		{Type: source.ImageAdded, Image: "app:v2", Source: src.Name(), Object: "default/sh.helm.release.v1.app.v2"},
+		{Type: source.ImageRemoved, Image: "app:v1", Source: src.Name(), Object: "default/sh.helm.release.v1.app.v2"},
+	}, events)
+	assert.ElementsMatch(t, received, []string{"app:v1", "redis:6"})
+	assert.ElementsMatch(t, src.Images(), []string{"app:v2", "redis:6"})
+}
+
+func Test_HelmSource_Rollback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		helmReleaseSecret("app", 1, "superseded", "app:v1"),
+		helmReleaseSecret("app", 2, "deployed", "app:v2"),
+	)
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image)
+
+	// A rollback creates a new revision with the manifest of the revision being rolled back to
+	_, err := fakeClient.CoreV1().Secrets("default").Create(ctx, helmReleaseSecret("app", 3, "deployed", "app:v1"), metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, err = fakeClient.CoreV1().Secrets("default").Update(ctx, helmReleaseSecret("app", 2, "superseded", "app:v2"), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"app:v2", "app:v1"})
+	assert.ElementsMatch(t, src.Images(), []string{"app:v1"})
+}
+
+func Test_HelmSource_Uninstall(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		helmReleaseSecret("app", 1, "deployed", "app:v1"),
+		helmReleaseSecret("other", 1, "deployed", "other:v1"),
+	)
+
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	err := fakeClient.CoreV1().Secrets("default").Delete(ctx, "sh.helm.release.v1.other.v1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"app:v1", "other:v1"})
+	assert.ElementsMatch(t, src.Images(), []string{"app:v1"})
+}
+
+func Test_HelmSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewHelmSource(fakeClient, time.Minute*15)
+	assert.Equal(t, "Helm", src.Name())
+}
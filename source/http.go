@@ -0,0 +1,222 @@
+package source
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/sirupsen/logrus"
+)
+
+type HTTPSourceOpts struct {
+	// URL serves a JSON or YAML list of images
+	URL string
+	// PollInterval is how often URL is requested
+	PollInterval time.Duration
+	// BearerTokenFile, if set, is read before every request and sent as a bearer token
+	BearerTokenFile string
+	// CAFile, if set, is a PEM bundle used to verify the server instead of the system roots
+	CAFile string
+	// Client, if set, is used instead of a client built from CAFile
+	Client *http.Client
+}
+
+// HTTPSource polls a URL for a list of images.  Conditional requests are used so that an unchanged list
+// is not transferred again, and the last list that was successfully fetched is kept whenever the
+// endpoint fails.
+type HTTPSource struct {
+	url             string
+	pollInterval    time.Duration
+	bearerTokenFile string
+	client          *http.Client
+	clock           clock.Clock
+	logger          *logrus.Logger
+	events          chan ImageEvent
+
+	etag         string
+	lastModified string
+
+	imageMap map[string]bool
+	images   []string
+	lock     sync.RWMutex
+}
+
+func NewHTTPSource(opts *HTTPSourceOpts) (ImageSource, error) {
+	if opts.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be greater than zero")
+	}
+
+	client := opts.Client
+
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+
+		if opts.CAFile != "" {
+			pem, err := ioutil.ReadFile(opts.CAFile)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle %s: %v", opts.CAFile, err)
+			}
+
+			pool := x509.NewCertPool()
+
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+			}
+
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		}
+
+		client = &http.Client{
+			Transport: transport,
+			Timeout:   time.Second * 30,
+		}
+	}
+
+	return &HTTPSource{
+		url:             opts.URL,
+		pollInterval:    opts.PollInterval,
+		bearerTokenFile: opts.BearerTokenFile,
+		client:          client,
+		clock:           clock.New(),
+		logger:          logrus.StandardLogger(),
+		events:          make(chan ImageEvent),
+		imageMap:        make(map[string]bool),
+		images:          make([]string, 0),
+	}, nil
+}
+
+func (hs *HTTPSource) Events() <-chan ImageEvent {
+	return hs.events
+}
+
+func (hs *HTTPSource) Images() []string {
+	hs.lock.RLock()
+	defer hs.lock.RUnlock()
+
+	return hs.images
+}
+
+func (*HTTPSource) Name() string {
+	return "HTTP"
+}
+
+// fetch requests the image list, returning nil without an error when it has not changed since the
+// previous request.
+func (hs *HTTPSource) fetch(ctx context.Context) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, application/yaml, */*")
+
+	if hs.bearerTokenFile != "" {
+		token, err := ioutil.ReadFile(hs.bearerTokenFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token %s: %v", hs.bearerTokenFile, err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	if hs.etag != "" {
+		req.Header.Set("If-None-Match", hs.etag)
+	}
+
+	if hs.lastModified != "" {
+		req.Header.Set("If-Modified-Since", hs.lastModified)
+	}
+
+	resp, err := hs.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	imageMap, err := parseImageList(string(body))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal images: %v", err)
+	}
+
+	// Only remember the validators once the list has been accepted, otherwise a bad response would
+	// never be fetched again.
+	hs.etag = resp.Header.Get("ETag")
+	hs.lastModified = resp.Header.Get("Last-Modified")
+
+	return imageMap, nil
+}
+
+func (hs *HTTPSource) poll(ctx context.Context) {
+	currentImages, err := hs.fetch(ctx)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			hs.logger.Errorf("failed to get images from %s, keeping the previous images: %v", hs.url, err)
+		}
+
+		return
+	}
+
+	if currentImages == nil {
+		return
+	}
+
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	emitImageChanges(hs.events, hs.Name(), "", hs.imageMap, currentImages)
+
+	hs.imageMap = currentImages
+
+	var images []string
+
+	for image := range currentImages {
+		images = append(images, image)
+	}
+
+	hs.images = images
+}
+
+func (hs *HTTPSource) Run(ctx context.Context) {
+	defer close(hs.events)
+
+	ticker := hs.clock.Ticker(hs.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		hs.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package source_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// imageListServer serves a mutable image list, honoring If-None-Match
+type imageListServer struct {
+	lock        sync.Mutex
+	body        string
+	etag        string
+	status      int
+	requests    int
+	notModified int
+	headers     []http.Header
+}
+
+func (s *imageListServer) set(status int, etag, body string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status, s.etag, s.body = status, etag, body
+}
+
+func (s *imageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests++
+	s.headers = append(s.headers, r.Header.Clone())
+
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+
+	w.WriteHeader(s.status)
+	_, _ = w.Write([]byte(s.body))
+}
+
+func Test_HTTPSource_Basic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	handler := &imageListServer{status: http.StatusOK, etag: `"v1"`, body: `["alpine", "debian"]`}
+	server := httptest.NewServer(handler)
+
+	t.Cleanup(server.Close)
+
+	src, err := source.NewHTTPSource(&source.HTTPSourceOpts{
+		URL:          server.URL,
+		PollInterval: time.Millisecond * 100,
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+
+	// Every request after the first should have been conditional
+	assert.Greater(t, handler.requests, 1)
+	assert.Equal(t, handler.requests-1, handler.notModified)
+}
+
+func Test_HTTPSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	handler := &imageListServer{status: http.StatusOK, etag: `"v1"`, body: `["alpine", "debian"]`}
+	server := httptest.NewServer(handler)
+
+	t.Cleanup(server.Close)
+
+	src, err := source.NewHTTPSource(&source.HTTPSourceOpts{
+		URL:          server.URL,
+		PollInterval: time.Millisecond * 100,
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	handler.set(http.StatusOK, `"v2"`, `
+- alpine
+- golang
+`)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "golang"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "golang"})
+}
+
+func Test_HTTPSource_KeepsLastGoodList(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	handler := &imageListServer{status: http.StatusOK, body: `["alpine", "debian"]`}
+	server := httptest.NewServer(handler)
+
+	t.Cleanup(server.Close)
+
+	src, err := source.NewHTTPSource(&source.HTTPSourceOpts{
+		URL:          server.URL,
+		PollInterval: time.Millisecond * 100,
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	handler.set(http.StatusInternalServerError, "", `["golang"]`)
+	time.Sleep(time.Millisecond * 300)
+	handler.set(http.StatusOK, "", `{"images": "golang"}`)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_HTTPSource_BearerTokenAndCA(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	handler := &imageListServer{status: http.StatusOK, body: `["alpine"]`}
+	server := httptest.NewTLSServer(handler)
+
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	tokenFile := filepath.Join(dir, "token")
+
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600))
+
+	src, err := source.NewHTTPSource(&source.HTTPSourceOpts{
+		URL:             server.URL,
+		PollInterval:    time.Second * 10,
+		BearerTokenFile: tokenFile,
+		CAFile:          caFile,
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+
+	assert.Equal(t, "Bearer s3cr3t", handler.headers[0].Get("Authorization"))
+}
+
+func Test_HTTPSource_InvalidOpts(t *testing.T) {
+	_, err := source.NewHTTPSource(&source.HTTPSourceOpts{URL: "http://example.com"})
+	assert.Error(t, err)
+
+	_, err = source.NewHTTPSource(&source.HTTPSourceOpts{URL: "http://example.com", PollInterval: time.Minute, CAFile: "/does/not/exist"})
+	assert.Error(t, err)
+}
+
+func Test_HTTPSource_Name(t *testing.T) {
+	src, err := source.NewHTTPSource(&source.HTTPSourceOpts{URL: "http://example.com", PollInterval: time.Minute})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "HTTP", src.Name())
+}
@@ -0,0 +1,380 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ImageCachePolicyResource is the resource of the ImageCachePolicy CRD found in manifests/crds
+var ImageCachePolicyResource = schema.GroupVersionResource{Group: "image-cache-daemon.io", Version: "v1alpha1", Resource: "imagecachepolicies"}
+
+// ImageCachePolicy requests that a set of images be cached on every node matching its node selector
+type ImageCachePolicy struct {
+	v1.TypeMeta   `json:",inline"`
+	v1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageCachePolicySpec   `json:"spec"`
+	Status ImageCachePolicyStatus `json:"status,omitempty"`
+}
+
+type ImageCachePolicySpec struct {
+	// Images are the images to cache
+	Images []string `json:"images"`
+	// NodeSelector restricts the nodes that cache the images.  Defaults to every node.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Priority orders the pulls of policies that are scheduled at the same time, highest first
+	Priority int32 `json:"priority,omitempty"`
+	// Schedule is a cron expression describing when the images should be pulled again, which
+	// refreshes images referenced by a mutable tag.  Defaults to pulling the images once.
+	Schedule string `json:"schedule,omitempty"`
+}
+
+type ImageCachePolicyStatus struct {
+	// ObservedGeneration is the generation of the spec that the status was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Images reports how many nodes have cached each image of the spec
+	Images []ImageCacheStatus `json:"images,omitempty"`
+}
+
+type ImageCacheStatus struct {
+	Image       string `json:"image"`
+	CachedNodes int32  `json:"cachedNodes"`
+}
+
+// imageCachePolicyFromObject converts an ImageCachePolicy read by a dynamic informer
+func imageCachePolicyFromObject(obj interface{}) (*ImageCachePolicy, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+
+	if !ok {
+		return nil, fmt.Errorf("could not cast input to unstructured.Unstructured")
+	}
+
+	var policy ImageCachePolicy
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &policy); err != nil {
+		return nil, fmt.Errorf("failed to convert image cache policy %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+	}
+
+	return &policy, nil
+}
+
+// scheduledPolicy tracks when the images of a policy with a schedule are pulled next
+type scheduledPolicy struct {
+	key      string
+	images   []string
+	priority int32
+	schedule string
+	parsed   cron.Schedule
+	next     time.Time
+}
+
+// ImageCachePolicySource emits the images of every ImageCachePolicy whose node selector matches
+// the node that the daemon is running on, and emits them again whenever their schedule is due.  The
+// images of every policy are recomputed whenever the labels of the node change.
+type ImageCachePolicySource struct {
+	*InformerSource
+
+	clock        clock.Clock
+	nodeInformer cache.SharedIndexInformer
+
+	// policies holds the spec of every policy that matches the node by key, and is guarded by
+	// policiesLock
+	policies     map[string]ImageCachePolicySpec
+	policiesLock sync.RWMutex
+	// scheduled holds the policies with a schedule by key, and is guarded by the lock
+	scheduled  map[string]*scheduledPolicy
+	scheduleCh chan struct{}
+}
+
+// getImagesFromImageCachePolicy must be called with the lock held, since it records the spec and
+// schedule of each policy.
+func (p *ImageCachePolicySource) getImagesFromImageCachePolicy(obj interface{}) (map[string]bool, error) {
+	policy, err := imageCachePolicyFromObject(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	imageMap := make(map[string]bool)
+
+	if !labels.SelectorFromSet(policy.Spec.NodeSelector).Matches(p.nodeLabels()) {
+		p.setPolicy(key, nil)
+		p.unschedule(key)
+		return imageMap, nil
+	}
+
+	p.setPolicy(key, &policy.Spec)
+
+	for _, image := range policy.Spec.Images {
+		imageMap[image] = true
+	}
+
+	p.schedule(key, policy)
+
+	return imageMap, nil
+}
+
+// nodeLabels returns the labels of the node that images are pulled to, which are empty until the node
+// has been observed
+func (p *ImageCachePolicySource) nodeLabels() labels.Set {
+	for _, obj := range p.nodeInformer.GetIndexer().List() {
+		if node, ok := obj.(*corev1.Node); ok {
+			return labels.Set(node.Labels)
+		}
+	}
+
+	return labels.Set{}
+}
+
+// nodeEventHandler recomputes the images of every policy whenever the labels of the node change
+func (p *ImageCachePolicySource) nodeEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.resync()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, oldOk := oldObj.(*corev1.Node)
+			newNode, newOk := newObj.(*corev1.Node)
+
+			if oldOk && newOk && !labels.Equals(oldNode.Labels, newNode.Labels) {
+				p.resync()
+			}
+		},
+	}
+}
+
+func (p *ImageCachePolicySource) HasSynced() bool {
+	return p.nodeInformer.HasSynced() && p.InformerSource.HasSynced()
+}
+
+// schedule records the schedule of policy.  Must be called with the lock held.
+func (p *ImageCachePolicySource) schedule(key string, policy *ImageCachePolicy) {
+	if policy.Spec.Schedule == "" {
+		p.unschedule(key)
+		return
+	}
+
+	sp, ok := p.scheduled[key]
+
+	if !ok || sp.schedule != policy.Spec.Schedule {
+		parsed, err := cron.ParseStandard(policy.Spec.Schedule)
+
+		if err != nil {
+			p.logger.Errorf("ignoring invalid schedule %q of image cache policy %s: %v", policy.Spec.Schedule, key, err)
+			p.unschedule(key)
+			return
+		}
+
+		sp = &scheduledPolicy{
+			key:      key,
+			schedule: policy.Spec.Schedule,
+			parsed:   parsed,
+			next:     parsed.Next(p.clock.Now()),
+		}
+
+		p.scheduled[key] = sp
+		p.wakeScheduler()
+	}
+
+	sp.images = policy.Spec.Images
+	sp.priority = policy.Spec.Priority
+}
+
+// unschedule forgets the schedule of the policy with key.  Must be called with the lock held.
+func (p *ImageCachePolicySource) unschedule(key string) {
+	if _, ok := p.scheduled[key]; ok {
+		delete(p.scheduled, key)
+		p.wakeScheduler()
+	}
+}
+
+// setPolicy records the spec of the policy with key, or drops it if spec is nil
+func (p *ImageCachePolicySource) setPolicy(key string, spec *ImageCachePolicySpec) {
+	p.policiesLock.Lock()
+	defer p.policiesLock.Unlock()
+
+	if spec == nil {
+		delete(p.policies, key)
+		return
+	}
+
+	p.policies[key] = *spec
+}
+
+func (p *ImageCachePolicySource) forgetImageCachePolicy(obj interface{}) {
+	if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+		p.setPolicy(key, nil)
+		p.unschedule(key)
+	}
+}
+
+// ImageOptions returns the priority of every policy that lists image.  Like ConfigMapSource, it never
+// waits for the lock of the source, which is held while events are sent.
+func (p *ImageCachePolicySource) ImageOptions(image string) []ImageOptions {
+	p.policiesLock.RLock()
+	defer p.policiesLock.RUnlock()
+
+	var options []ImageOptions
+
+	for _, spec := range p.policies {
+		for _, policyImage := range spec.Images {
+			if policyImage == image {
+				options = append(options, ImageOptions{Priority: spec.Priority})
+				break
+			}
+		}
+	}
+
+	return options
+}
+
+func (p *ImageCachePolicySource) wakeScheduler() {
+	select {
+	case p.scheduleCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextRun returns the earliest time that a schedule is due.  Must be called with the lock held.
+func (p *ImageCachePolicySource) nextRun() (time.Time, bool) {
+	var next time.Time
+
+	for _, sp := range p.scheduled {
+		if next.IsZero() || sp.next.Before(next) {
+			next = sp.next
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// pullScheduled emits a Resync event for the images of every policy whose schedule is due, in order of
+// priority
+func (p *ImageCachePolicySource) pullScheduled() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	now := p.clock.Now()
+
+	var due []*scheduledPolicy
+
+	for _, sp := range p.scheduled {
+		if !sp.next.After(now) {
+			due = append(due, sp)
+			sp.next = sp.parsed.Next(now)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].priority > due[j].priority
+	})
+
+	emitted := make(map[string]bool)
+
+	for _, sp := range due {
+		for _, image := range sp.images {
+			// Policies whose namespace has left the scope remain scheduled until they are recomputed
+			if is := p.InformerSource; is.imageMap[image] && !emitted[image] {
+				emitted[image] = true
+				is.events <- ImageEvent{Type: ImageResync, Image: image, Source: is.sourceName, Object: sp.key}
+			}
+		}
+	}
+}
+
+func (p *ImageCachePolicySource) runSchedules(ctx context.Context) {
+	for {
+		p.lock.RLock()
+		next, ok := p.nextRun()
+		p.lock.RUnlock()
+
+		var timer *clock.Timer
+		var timerCh <-chan time.Time
+
+		if ok {
+			timer = p.clock.Timer(next.Sub(p.clock.Now()))
+			timerCh = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+
+			return
+		case <-p.scheduleCh:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-timerCh:
+			p.pullScheduled()
+		}
+	}
+}
+
+func (p *ImageCachePolicySource) Run(ctx context.Context) {
+	go p.runSchedules(ctx)
+
+	p.nodeInformer.AddEventHandler(p.nodeEventHandler())
+	go p.nodeInformer.Run(ctx.Done())
+
+	p.InformerSource.Run(ctx)
+}
+
+// NewImageCachePolicySource creates a source that emits the images of every ImageCachePolicy whose
+// node selector matches the labels of nodeName, the node that images are pulled to.
+func NewImageCachePolicySource(client dynamic.Interface, kubeClient kubernetes.Interface, resyncPeriod time.Duration, nodeName string) ImageSource {
+	nodeFac := informers.NewSharedInformerFactoryWithOptions(kubeClient, resyncPeriod, informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+		lo.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+	}))
+
+	p := &ImageCachePolicySource{
+		clock:        clock.New(),
+		nodeInformer: nodeFac.Core().V1().Nodes().Informer(),
+		policies:     make(map[string]ImageCachePolicySpec),
+		scheduled:    make(map[string]*scheduledPolicy),
+		scheduleCh:   make(chan struct{}, 1),
+	}
+
+	p.InformerSource = NewInformerSource(&InformerSourceOpts{
+		sourceName: "ImageCachePolicy",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, namespace, nil)
+			return newImageInformers(p.getImagesFromImageCachePolicy, fac.ForResource(ImageCachePolicyResource).Informer())
+		},
+		resyncPeriod: resyncPeriod,
+	})
+
+	p.onDelete = p.forgetImageCachePolicy
+
+	return p
+}
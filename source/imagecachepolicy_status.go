@@ -0,0 +1,216 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CachedImagesAnnotation is set by every daemon on its own pod to a JSON list of the images that it
+// has successfully pulled to its node
+const CachedImagesAnnotation = "image-cache-daemon/cached-images"
+
+// ImageCachePolicyStatusWriter aggregates the CachedImagesAnnotation of every daemon pod into the
+// status of each ImageCachePolicy.  A status that is already up to date is never written.  Since it
+// watches every daemon pod, it should only run on a single daemon at a time; see
+// RunElectedImageCachePolicyStatusWriter.
+type ImageCachePolicyStatusWriter struct {
+	client   dynamic.Interface
+	logger   *logrus.Logger
+	clock    clock.Clock
+	interval time.Duration
+
+	daemonPods cache.SharedIndexInformer
+	policies   *scopedInformers
+}
+
+// NewImageCachePolicyStatusWriter creates a writer that counts the images cached by the daemon pods
+// in daemonNamespace matching daemonSelector, and updates the status of every ImageCachePolicy once
+// per interval.
+func NewImageCachePolicyStatusWriter(client dynamic.Interface, kubeClient kubernetes.Interface, daemonNamespace, daemonSelector string, interval time.Duration) *ImageCachePolicyStatusWriter {
+	podFac := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithNamespace(daemonNamespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+		lo.LabelSelector = daemonSelector
+	}))
+
+	w := &ImageCachePolicyStatusWriter{
+		client:     client,
+		logger:     logrus.StandardLogger(),
+		clock:      clock.New(),
+		interval:   interval,
+		daemonPods: podFac.Core().V1().Pods().Informer(),
+		policies:   newScopedInformers(),
+	}
+
+	w.policies.newInformers = func(namespace string) []imageInformer {
+		fac := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, namespace, nil)
+		return newImageInformers(nil, fac.ForResource(ImageCachePolicyResource).Informer())
+	}
+
+	return w
+}
+
+// SetNamespaceScope restricts the policies whose status is written to the namespaces of scope.  Must
+// be called before Run.
+func (w *ImageCachePolicyStatusWriter) SetNamespaceScope(scope *NamespaceScope) {
+	w.policies.scope = scope
+}
+
+func (w *ImageCachePolicyStatusWriter) HasSynced() bool {
+	return w.daemonPods.HasSynced() && w.policies.hasSynced()
+}
+
+// cachedNodes returns the number of nodes that have cached each image.  A node is only counted
+// once, even while the daemon pod of that node is being replaced.
+func (w *ImageCachePolicyStatusWriter) cachedNodes() map[string]int32 {
+	nodesByImage := make(map[string]map[string]bool)
+
+	for _, obj := range w.daemonPods.GetIndexer().List() {
+		pod, ok := obj.(*corev1.Pod)
+
+		if !ok || pod.Spec.NodeName == "" {
+			continue
+		}
+
+		value, ok := pod.Annotations[CachedImagesAnnotation]
+
+		if !ok {
+			continue
+		}
+
+		var images []string
+
+		if err := json.Unmarshal([]byte(value), &images); err != nil {
+			w.logger.Warnf("ignoring invalid %s annotation of pod %s/%s: %v", CachedImagesAnnotation, pod.Namespace, pod.Name, err)
+			continue
+		}
+
+		for _, image := range images {
+			if nodesByImage[image] == nil {
+				nodesByImage[image] = make(map[string]bool)
+			}
+
+			nodesByImage[image][pod.Spec.NodeName] = true
+		}
+	}
+
+	counts := make(map[string]int32)
+
+	for image, nodes := range nodesByImage {
+		counts[image] = int32(len(nodes))
+	}
+
+	return counts
+}
+
+func (w *ImageCachePolicyStatusWriter) writeStatuses(ctx context.Context) {
+	counts := w.cachedNodes()
+
+	for _, ii := range w.policies.list() {
+		for _, obj := range ii.informer.GetIndexer().List() {
+			if err := w.writeStatus(ctx, obj, counts); err != nil {
+				w.logger.Errorf("failed to write image cache policy status: %v", err)
+			}
+		}
+	}
+}
+
+func (w *ImageCachePolicyStatusWriter) writeStatus(ctx context.Context, obj interface{}, counts map[string]int32) error {
+	policy, err := imageCachePolicyFromObject(obj)
+
+	if err != nil {
+		return err
+	}
+
+	status := ImageCachePolicyStatus{
+		ObservedGeneration: policy.Generation,
+	}
+
+	for _, image := range policy.Spec.Images {
+		status.Images = append(status.Images, ImageCacheStatus{
+			Image:       image,
+			CachedNodes: counts[image],
+		})
+	}
+
+	if equality.Semantic.DeepEqual(status, policy.Status) {
+		return nil
+	}
+
+	rawStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+
+	if err != nil {
+		return err
+	}
+
+	updated := obj.(*unstructured.Unstructured).DeepCopy()
+	updated.Object["status"] = rawStatus
+
+	_, err = w.client.Resource(ImageCachePolicyResource).Namespace(policy.Namespace).UpdateStatus(ctx, updated, v1.UpdateOptions{})
+
+	// Another daemon wrote the status first, which is retried on the next interval if it differs
+	if errors.IsConflict(err) {
+		w.logger.Debugf("image cache policy %s/%s was modified while writing its status", policy.Namespace, policy.Name)
+		return nil
+	}
+
+	return err
+}
+
+// imageCachePolicyStatusLease is the Lease in the daemon namespace that elects the daemon writing the
+// status of ImageCachePolicies
+const imageCachePolicyStatusLease = "image-cache-daemon-policy-status"
+
+// RunElectedImageCachePolicyStatusWriter runs a writer created by newWriter while the daemon identified
+// by identity holds the Lease for writing the status of ImageCachePolicies in daemonNamespace, and
+// stands by for the next election otherwise.  A new writer is created for every term, since the
+// informers of a writer cannot be restarted once stopped.
+func RunElectedImageCachePolicyStatusWriter(ctx context.Context, kubeClient kubernetes.Interface, daemonNamespace, identity string, newWriter func() *ImageCachePolicyStatusWriter) {
+	runElected(ctx, kubeClient, daemonNamespace, imageCachePolicyStatusLease, identity, "write the status of image cache policies", func(leaderCtx context.Context) {
+		newWriter().Run(leaderCtx)
+	})
+}
+
+func (w *ImageCachePolicyStatusWriter) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		w.daemonPods.Run(ctx.Done())
+	}()
+
+	go func() {
+		defer wg.Done()
+		w.policies.run(ctx)
+	}()
+
+	ticker := w.clock.Ticker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if w.HasSynced() {
+				w.writeStatuses(ctx)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func imageCachePolicy(name string, spec ImageCachePolicySpec) *unstructured.Unstructured {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&ImageCachePolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "image-cache-daemon.io/v1alpha1",
+			Kind:       "ImageCachePolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Generation: 1,
+		},
+		Spec: spec,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newFakeImageCachePolicyClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ImageCachePolicyResource: "ImageCachePolicyList",
+	}, objects...)
+}
+
+func node(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func daemonPod(name, nodeName string, cachedImages string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "image-cache-daemon",
+			Labels: map[string]string{
+				"app": "image-cache-daemon",
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+		},
+	}
+
+	if cachedImages != "" {
+		pod.Annotations = map[string]string{
+			CachedImagesAnnotation: cachedImages,
+		}
+	}
+
+	return pod
+}
+
+func Test_ImageCachePolicySource_NodeSelector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeImageCachePolicyClient(
+		imageCachePolicy("everywhere", ImageCachePolicySpec{Images: []string{"alpine"}}),
+		imageCachePolicy("gpu", ImageCachePolicySpec{Images: []string{"cuda"}, NodeSelector: map[string]string{"gpu": "true"}}),
+		imageCachePolicy("arm", ImageCachePolicySpec{Images: []string{"debian"}, NodeSelector: map[string]string{"kubernetes.io/arch": "arm64"}}),
+	)
+
+	kubeClient := fake.NewSimpleClientset(node("node", map[string]string{"gpu": "true", "kubernetes.io/arch": "amd64"}))
+
+	src := NewImageCachePolicySource(fakeClient, kubeClient, time.Minute*15, "node")
+	assert.Equal(t, "ImageCachePolicy", src.Name())
+
+	go src.Run(ctx)
+
+	var received []string
+
+	for event := range src.Events() {
+		received = append(received, event.Image)
+	}
+
+	assert.ElementsMatch(t, received, []string{"alpine", "cuda"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "cuda"})
+}
+
+func Test_ImageCachePolicySource_NodeLabelsChange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeImageCachePolicyClient(
+		imageCachePolicy("everywhere", ImageCachePolicySpec{Images: []string{"alpine"}}),
+		imageCachePolicy("gpu", ImageCachePolicySpec{Images: []string{"cuda"}, NodeSelector: map[string]string{"gpu": "true"}}),
+	)
+
+	kubeClient := fake.NewSimpleClientset(node("node", nil))
+
+	src := NewImageCachePolicySource(fakeClient, kubeClient, time.Minute*15, "node")
+
+	go src.Run(ctx)
+
+	policySource := src.(*ImageCachePolicySource)
+
+	for !policySource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Policies may be handled before or after the node is observed or changes, which decides whether
+	// their images are emitted on behalf of the policy or of the node, so the object is not compared
+	next := func() ImageEvent {
+		event := <-src.Events()
+		event.Object = ""
+		return event
+	}
+
+	assert.Equal(t, ImageEvent{Type: ImageAdded, Image: "alpine", Source: src.Name()}, next())
+
+	// A node that gains a label gains the policies that select it, and loses them again with the label
+	_, err := kubeClient.CoreV1().Nodes().Update(ctx, node("node", map[string]string{"gpu": "true"}), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ImageEvent{Type: ImageAdded, Image: "cuda", Source: src.Name()}, next())
+	assert.ElementsMatch(t, []string{"alpine", "cuda"}, src.Images())
+
+	_, err = kubeClient.CoreV1().Nodes().Update(ctx, node("node", nil), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ImageEvent{Type: ImageRemoved, Image: "cuda", Source: src.Name()}, next())
+	assert.ElementsMatch(t, []string{"alpine"}, src.Images())
+}
+
+func Test_ImageCachePolicySource_Schedule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeImageCachePolicyClient(
+		imageCachePolicy("once", ImageCachePolicySpec{Images: []string{"alpine"}}),
+		imageCachePolicy("low", ImageCachePolicySpec{Images: []string{"debian"}, Schedule: "0 * * * *", Priority: 1}),
+		imageCachePolicy("high", ImageCachePolicySpec{Images: []string{"ubuntu"}, Schedule: "0 * * * *", Priority: 10}),
+		imageCachePolicy("invalid", ImageCachePolicySpec{Images: []string{"busybox"}, Schedule: "whenever"}),
+	)
+
+	mockClock := clock.NewMock()
+
+	src := NewImageCachePolicySource(fakeClient, fake.NewSimpleClientset(node("node", nil)), time.Minute*15, "node")
+	src.(*ImageCachePolicySource).clock = mockClock
+
+	go src.Run(ctx)
+
+	var received []string
+
+	for len(received) < 4 {
+		event := <-src.Events()
+		assert.Equal(t, ImageAdded, event.Type)
+		received = append(received, event.Image)
+	}
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu", "busybox"})
+
+	// The scheduler may not have observed the schedules yet, so the clock is advanced until it has
+	var scheduled []string
+	var objects []string
+
+	for len(scheduled) < 2 {
+		select {
+		case event := <-src.Events():
+			// Scheduled images are already held by the source, and are only pulled again
+			assert.Equal(t, ImageResync, event.Type)
+			scheduled = append(scheduled, event.Image)
+			objects = append(objects, event.Object)
+		case <-time.After(time.Millisecond * 10):
+			if len(scheduled) == 0 {
+				mockClock.Add(time.Minute * 30)
+			}
+		}
+	}
+
+	// Policies that are due at the same time are pulled in order of priority
+	assert.Equal(t, []string{"ubuntu", "debian"}, scheduled)
+	assert.Equal(t, []string{"default/high", "default/low"}, objects)
+}
+
+func Test_ImageCachePolicyStatusWriter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := newFakeImageCachePolicyClient(
+		imageCachePolicy("policy", ImageCachePolicySpec{Images: []string{"alpine", "debian", "ubuntu"}}),
+	)
+
+	fakeKubeClient := fake.NewSimpleClientset(
+		daemonPod("daemon-1", "node-1", `["alpine","debian"]`),
+		daemonPod("daemon-2", "node-2", `["alpine"]`),
+		// A replacement daemon pod of a node is not counted twice
+		daemonPod("daemon-3", "node-2", `["alpine"]`),
+		daemonPod("daemon-4", "node-3", `not json`),
+		daemonPod("daemon-5", "node-4", ""),
+	)
+
+	mockClock := clock.NewMock()
+
+	w := NewImageCachePolicyStatusWriter(fakeClient, fakeKubeClient, "image-cache-daemon", "app=image-cache-daemon", time.Minute)
+	w.clock = mockClock
+
+	go w.Run(ctx)
+
+	expected := ImageCachePolicyStatus{
+		ObservedGeneration: 1,
+		Images: []ImageCacheStatus{
+			{Image: "alpine", CachedNodes: 2},
+			{Image: "debian", CachedNodes: 1},
+			{Image: "ubuntu", CachedNodes: 0},
+		},
+	}
+
+	for {
+		mockClock.Add(time.Minute)
+
+		obj, err := fakeClient.Resource(ImageCachePolicyResource).Namespace("default").Get(ctx, "policy", metav1.GetOptions{})
+		assert.NoError(t, err)
+
+		policy, err := imageCachePolicyFromObject(obj)
+		assert.NoError(t, err)
+
+		if len(policy.Status.Images) > 0 {
+			assert.Equal(t, expected, policy.Status)
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("status was never written")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
@@ -0,0 +1,555 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/cache"
+)
+
+type InformerSourceOpts struct {
+	sourceName              string
+	extractImagesFromObject func(obj interface{}) (map[string]bool, error)
+	informers               []cache.SharedIndexInformer
+	resyncPeriod            time.Duration
+	logger                  *logrus.Logger
+
+	// namespacedInformers, if set, creates the informers of a single namespace.  It is called once
+	// for every namespace within the NamespaceScope of the source as the namespace is observed, or
+	// once with v1.NamespaceAll if the source has no scope.
+	namespacedInformers func(namespace string) []imageInformer
+
+	// recomputeOnChange should be set when the images of an object depend on other objects in the
+	// informers, in which case the images of every object are recomputed whenever any of them change.
+	recomputeOnChange bool
+
+	// onChange, if set, is called with the lock held once the images of an added or updated object
+	// were emitted, and returns whether the images of other objects may have changed as a result.  The
+	// images of every object are then recomputed, which is only worthwhile when extractImagesFromObject
+	// is cheap for objects that did not change.
+	onChange func(obj interface{}) bool
+
+	// recomputeInterval, if set, checks the objects of every informer with a due function at that
+	// interval of clock, for sources whose images depend on the current time.  See recomputeDue.
+	recomputeInterval time.Duration
+	clock             clock.Clock
+}
+
+// NewInformerSource creates an ImageSource that watches one or more informers and emits every
+// image returned by extractImagesFromObject for the objects they contain.
+func NewInformerSource(opts *InformerSourceOpts) *InformerSource {
+	logger := opts.logger
+
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	is := &InformerSource{
+		sourceName:          opts.sourceName,
+		resyncPeriod:        opts.resyncPeriod,
+		recomputeOnChange:   opts.recomputeOnChange,
+		onChange:            opts.onChange,
+		recomputeInterval:   opts.recomputeInterval,
+		clock:               opts.clock,
+		namespacedInformers: opts.namespacedInformers,
+		scoped:              newScopedInformers(),
+		logger:              logger,
+		lock:                sync.RWMutex{},
+		imageMap:            make(map[string]bool),
+		images:              make([]string, 0),
+		events:              make(chan ImageEvent),
+	}
+
+	for _, informer := range opts.informers {
+		is.addInformer(informer, opts.extractImagesFromObject)
+	}
+
+	return is
+}
+
+type imageInformer struct {
+	informer                cache.SharedIndexInformer
+	extractImagesFromObject func(obj interface{}) (map[string]bool, error)
+
+	// ignore, if set, skips the events of objects that cannot currently contribute any images
+	ignore func(obj interface{}) bool
+	// ignoreUpdate, if set, skips updates that cannot change the images of an object
+	ignoreUpdate func(oldObj, newObj interface{}) bool
+	// due, if set, returns whether the schedule of an object currently calls for its images.  It must
+	// be cheap, since it is called for every object of the informer once per recomputeInterval.
+	due func(obj interface{}) bool
+}
+
+// dueKey identifies an object of an informer with a due function
+type dueKey struct {
+	informer cache.SharedIndexInformer
+	key      string
+}
+
+// newImageInformers pairs every informer with extractImagesFromObject
+func newImageInformers(extractImagesFromObject func(obj interface{}) (map[string]bool, error), informers ...cache.SharedIndexInformer) []imageInformer {
+	var iis []imageInformer
+
+	for _, informer := range informers {
+		iis = append(iis, imageInformer{
+			informer:                informer,
+			extractImagesFromObject: extractImagesFromObject,
+		})
+	}
+
+	return iis
+}
+
+// InformerSource implements the add/update/delete diffing shared by every source that is backed
+// by informers.  Images are emitted as soon as an object that uses them is added or updated, and
+// the full set of images is recomputed from the informer caches whenever an image may have been
+// removed, emitting an ImageRemoved event for every image that is no longer used.  Objects that are
+// redelivered unchanged by the informer every resyncPeriod emit an ImageResync event for their images.
+type InformerSource struct {
+	sourceName        string
+	logger            *logrus.Logger
+	events            chan ImageEvent
+	resyncPeriod      time.Duration
+	recomputeOnChange bool
+	recomputeInterval time.Duration
+	clock             clock.Clock
+
+	// onDelete, if set, is called with the lock held whenever an object is deleted
+	onDelete func(obj interface{})
+	// onChange is described by InformerSourceOpts
+	onChange func(obj interface{}) bool
+
+	informers           []imageInformer
+	namespacedInformers func(namespace string) []imageInformer
+	scoped              *scopedInformers
+	imageMap            map[string]bool
+	images              []string
+	lock                sync.RWMutex
+	stopped             bool
+
+	// dueObjects holds the result of the due function of every object as of the last recomputeDue,
+	// and is nil until then
+	dueObjects map[dueKey]bool
+}
+
+// addInformer registers an informer whose objects are passed to extractImagesFromObject.  Must be
+// called before Run.
+func (is *InformerSource) addInformer(informer cache.SharedIndexInformer, extractImagesFromObject func(obj interface{}) (map[string]bool, error)) {
+	is.informers = append(is.informers, imageInformer{
+		informer:                informer,
+		extractImagesFromObject: extractImagesFromObject,
+	})
+}
+
+// SetNamespaceScope restricts the namespaced informers of the source to the namespaces of scope.
+// Sources without namespaced informers are unaffected.  Must be called before Run.
+func (is *InformerSource) SetNamespaceScope(scope *NamespaceScope) {
+	is.scoped.scope = scope
+}
+
+// allInformers returns the informers of the source, including those of every namespace that is
+// currently watched.
+func (is *InformerSource) allInformers() []imageInformer {
+	return append(append([]imageInformer{}, is.informers...), is.scoped.list()...)
+}
+
+func (is *InformerSource) Events() <-chan ImageEvent {
+	return is.events
+}
+
+func (is *InformerSource) Images() []string {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+
+	return is.images
+}
+
+func (is *InformerSource) Name() string {
+	return is.sourceName
+}
+
+// objectKey returns the key of obj for ImageEvent.Object, or an empty string if it has none
+func objectKey(obj interface{}) string {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+
+	if err != nil {
+		return ""
+	}
+
+	return key
+}
+
+// updateImagesFromInformers recomputes the images of the source on behalf of object, which is the key
+// of the object whose change caused the recompute if there is one
+func (is *InformerSource) updateImagesFromInformers(object string) {
+	is.setImages(is.getImagesFromInformers(), object)
+}
+
+// setImages replaces the images of the source, emitting the images that were added or removed on
+// behalf of object.  Must be called with the lock held.
+func (is *InformerSource) setImages(imageMap map[string]bool, object string) {
+	emitImageChanges(is.events, is.sourceName, object, is.imageMap, imageMap)
+
+	is.imageMap = imageMap
+
+	var images []string
+
+	for key := range is.imageMap {
+		images = append(images, key)
+	}
+
+	is.images = images
+}
+
+func (is *InformerSource) getImagesFromInformers() map[string]bool {
+	imageMap := make(map[string]bool)
+
+	for _, ii := range is.allInformers() {
+		indexer := ii.informer.GetIndexer()
+
+		for _, key := range indexer.ListKeys() {
+			value, exists, err := indexer.GetByKey(key)
+
+			if !exists {
+				is.logger.Warnf("key %s did not exist in indexer", key)
+			} else if err != nil {
+				is.logger.Errorf("failed to retrieve key %s from indexer: %v", key, err)
+			} else {
+				images, err := ii.extractImagesFromObject(value)
+
+				if err != nil {
+					is.logger.Errorf("failed to get images from %s: %v", is.sourceName, err)
+					continue
+				}
+
+				for image := range images {
+					imageMap[image] = true
+				}
+			}
+		}
+	}
+
+	return imageMap
+}
+
+// resync recomputes the images from every informer, emitting any image that was added or removed.
+// This is used when something other than the watched objects affects their images.
+func (is *InformerSource) resync() {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if is.stopped {
+		return
+	}
+
+	is.recompute("")
+}
+
+// recompute recomputes the images from every informer, emitting any image that was added or
+// removed on behalf of object.  Must be called with the lock held.
+func (is *InformerSource) recompute(object string) {
+	is.updateImagesFromInformers(object)
+}
+
+func (is *InformerSource) HasSynced() bool {
+	// A scope may legitimately select no namespaces at all, so the scope decides for namespaced informers
+	if len(is.informers) == 0 && is.namespacedInformers == nil {
+		return false
+	}
+
+	if is.namespacedInformers != nil && !is.scoped.hasSynced() {
+		return false
+	}
+
+	for _, ii := range is.informers {
+		if !ii.informer.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addImages emits the images that the source does not hold yet on behalf of object.  Must be called
+// with the lock held.
+func (is *InformerSource) addImages(images map[string]bool, object string) {
+	newImages := setDifference(images, is.imageMap)
+
+	for _, image := range newImages {
+		is.imageMap[image] = true
+		is.images = append(is.images, image)
+		is.events <- ImageEvent{Type: ImageAdded, Image: image, Source: is.sourceName, Object: object}
+	}
+}
+
+// resyncImages emits a Resync event for every image of obj that the source holds.  Must be called
+// with the lock held.
+func (is *InformerSource) resyncImages(extractImagesFromObject func(obj interface{}) (map[string]bool, error), obj interface{}) {
+	images, err := extractImagesFromObject(obj)
+
+	if err != nil {
+		is.logger.Errorf("failed to get images from %s: %v", is.sourceName, err)
+		return
+	}
+
+	for image := range images {
+		if is.imageMap[image] {
+			is.events <- ImageEvent{Type: ImageResync, Image: image, Source: is.sourceName, Object: objectKey(obj)}
+		}
+	}
+}
+
+// eventHandler handles the events of ii, which belongs to sn if it was started for a namespace
+func (is *InformerSource) eventHandler(ii imageInformer, sn *scopedNamespace) cache.ResourceEventHandler {
+	extractImagesFromObject := ii.extractImagesFromObject
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			is.lock.Lock()
+			defer is.lock.Unlock()
+
+			if sn != nil && !is.scoped.isActive(sn) {
+				return
+			}
+
+			if ii.ignore != nil && ii.ignore(obj) {
+				return
+			}
+
+			if is.recomputeOnChange {
+				is.recompute(objectKey(obj))
+				return
+			}
+
+			images, err := extractImagesFromObject(obj)
+
+			if err != nil {
+				is.logger.Errorf("failed to get images from %s: %v", is.sourceName, err)
+				return
+			}
+
+			is.addImages(images, objectKey(obj))
+
+			if is.onChange != nil && is.onChange(obj) {
+				is.updateImagesFromInformers(objectKey(obj))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			is.lock.Lock()
+			defer is.lock.Unlock()
+
+			if sn != nil && !is.scoped.isActive(sn) {
+				return
+			}
+
+			if ii.ignore != nil && ii.ignore(newObj) && ii.ignore(oldObj) {
+				return
+			}
+
+			// The informer redelivers unchanged objects once per resyncPeriod
+			if isResync(oldObj, newObj) {
+				is.resyncImages(extractImagesFromObject, newObj)
+				return
+			}
+
+			if ii.ignoreUpdate != nil && ii.ignoreUpdate(oldObj, newObj) {
+				return
+			}
+
+			if is.recomputeOnChange {
+				is.recompute(objectKey(newObj))
+				return
+			}
+
+			// The previous images are extracted first so that any state recorded by
+			// extractImagesFromObject reflects the current object.
+			previousImages, previousErr := extractImagesFromObject(oldObj)
+			currentImages, err := extractImagesFromObject(newObj)
+
+			if err != nil {
+				is.logger.Errorf("failed to get images from %s: %v", is.sourceName, err)
+				return
+			}
+
+			if previousErr != nil {
+				is.logger.Errorf("failed to get images from %s: %v", is.sourceName, previousErr)
+				is.logger.Warnf("skipping deletion detection, could not parse prior images from %s", is.sourceName)
+				previousImages = currentImages
+			}
+
+			deletedImages := setDifference(previousImages, currentImages)
+
+			is.addImages(currentImages, objectKey(newObj))
+
+			if len(deletedImages) > 0 || (is.onChange != nil && is.onChange(newObj)) {
+				is.updateImagesFromInformers(objectKey(newObj))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			is.lock.Lock()
+			defer is.lock.Unlock()
+
+			if sn != nil && !is.scoped.isActive(sn) {
+				return
+			}
+
+			if ii.ignore != nil && ii.ignore(obj) {
+				return
+			}
+
+			if is.onDelete != nil {
+				is.onDelete(obj)
+			}
+
+			is.updateImagesFromInformers(objectKey(obj))
+		},
+	}
+}
+
+// recomputeDue emits the images of every object whose schedule started calling for them since the
+// last call, and recomputes the images of every object if the schedule of any object stopped calling
+// for them, the same as when an update removes images.  Objects whose informer has no due function
+// are left alone, so that the images of every Job are not extracted again once per recomputeInterval
+// just because CronJobs are watched along with them.
+func (is *InformerSource) recomputeDue() {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	if is.stopped {
+		return
+	}
+
+	type dueObject struct {
+		ii  imageInformer
+		obj interface{}
+	}
+
+	dueObjects := make(map[dueKey]bool)
+
+	var started []dueObject
+	stopped := false
+
+	for _, ii := range is.allInformers() {
+		if ii.due == nil {
+			continue
+		}
+
+		for _, obj := range ii.informer.GetIndexer().List() {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+
+			if err != nil {
+				continue
+			}
+
+			dk := dueKey{informer: ii.informer, key: key}
+			due := ii.due(obj)
+			dueObjects[dk] = due
+
+			// Objects observed since the last call may have been extracted either side of a boundary
+			previous, known := is.dueObjects[dk]
+
+			if due && (!known || !previous) {
+				started = append(started, dueObject{ii: ii, obj: obj})
+			} else if !due && (!known || previous) {
+				stopped = true
+			}
+		}
+	}
+
+	is.dueObjects = dueObjects
+
+	if stopped || (is.recomputeOnChange && len(started) > 0) {
+		is.recompute("")
+		return
+	}
+
+	for _, do := range started {
+		images, err := do.ii.extractImagesFromObject(do.obj)
+
+		if err != nil {
+			is.logger.Errorf("failed to get images from %s: %v", is.sourceName, err)
+			continue
+		}
+
+		is.addImages(images, objectKey(do.obj))
+	}
+}
+
+// runRecompute calls recomputeDue once per recomputeInterval until ctx is done
+func (is *InformerSource) runRecompute(ctx context.Context) {
+	ticker := is.clock.Ticker(is.recomputeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if is.HasSynced() {
+				is.recomputeDue()
+			}
+		}
+	}
+}
+
+func (is *InformerSource) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+
+	for _, ii := range is.informers {
+		ii.informer.AddEventHandlerWithResyncPeriod(is.eventHandler(ii, nil), is.resyncPeriod)
+
+		wg.Add(1)
+
+		go func(informer cache.SharedIndexInformer) {
+			defer wg.Done()
+			informer.Run(ctx.Done())
+		}(ii.informer)
+	}
+
+	if is.recomputeInterval > 0 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			is.runRecompute(ctx)
+		}()
+	}
+
+	if is.namespacedInformers != nil {
+		is.scoped.newInformers = is.namespacedInformers
+
+		is.scoped.onStart = func(sn *scopedNamespace) {
+			for _, ii := range sn.informers {
+				ii.informer.AddEventHandlerWithResyncPeriod(is.eventHandler(ii, sn), is.resyncPeriod)
+			}
+		}
+
+		// The objects of a namespace that leaves the scope no longer contribute any images
+		is.scoped.onStop = func(namespace string) {
+			is.lock.Lock()
+			defer is.lock.Unlock()
+
+			if !is.stopped {
+				is.updateImagesFromInformers("")
+			}
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			is.scoped.run(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	is.stopped = true
+	close(is.events)
+}
@@ -0,0 +1,105 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+func isSuspended(suspend *bool) bool {
+	return suspend != nil && *suspend
+}
+
+// isCronJobDue returns whether the images of cronJob are currently needed, which is only while window
+// contains one of its runs if window is set
+func isCronJobDue(cronJob *batchv1.CronJob, skipSuspended bool, window *CronWindow) (bool, error) {
+	if skipSuspended && isSuspended(cronJob.Spec.Suspend) {
+		return false, nil
+	}
+
+	if window == nil {
+		return true, nil
+	}
+
+	// The schedule may select a timezone with a CRON_TZ= prefix
+	due, err := window.contains(cronJob.Spec.Schedule, len(cronJob.Status.Active) > 0)
+
+	if err != nil {
+		return false, fmt.Errorf("invalid schedule of cronjob %s/%s: %v", cronJob.Namespace, cronJob.Name, err)
+	}
+
+	return due, nil
+}
+
+// getImagesFromJobFn returns the images of Jobs and CronJobs.  If window is set, CronJobs only
+// contribute images while it contains one of their runs.
+func getImagesFromJobFn(skipSuspended bool, window *CronWindow) func(obj interface{}) (map[string]bool, error) {
+	return func(obj interface{}) (map[string]bool, error) {
+		switch job := obj.(type) {
+		case *batchv1.Job:
+			if skipSuspended && isSuspended(job.Spec.Suspend) {
+				return map[string]bool{}, nil
+			}
+
+			return getImageSetFromPodSpec(&job.Spec.Template.Spec), nil
+		case *batchv1.CronJob:
+			due, err := isCronJobDue(job, skipSuspended, window)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !due {
+				return map[string]bool{}, nil
+			}
+
+			return getImageSetFromPodSpec(&job.Spec.JobTemplate.Spec.Template.Spec), nil
+		default:
+			return nil, fmt.Errorf("could not cast input to batchv1.Job or batchv1.CronJob, got %T", obj)
+		}
+	}
+}
+
+// NewJobSource creates a source that emits the images of every Job and CronJob matching selector.
+// If window is set, the images of CronJobs are only emitted around their runs.
+func NewJobSource(client kubernetes.Interface, resyncPeriod time.Duration, selector string, skipSuspended bool, window *CronWindow) ImageSource {
+	opts := &InformerSourceOpts{
+		sourceName: "Job",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			}))
+
+			iis := newImageInformers(getImagesFromJobFn(skipSuspended, window), fac.Batch().V1().Jobs().Informer(), fac.Batch().V1().CronJobs().Informer())
+
+			// Only the CronJobs are checked as their windows open and close
+			if window != nil {
+				iis[1].due = func(obj interface{}) bool {
+					cronJob, ok := obj.(*batchv1.CronJob)
+
+					if !ok {
+						return false
+					}
+
+					due, err := isCronJobDue(cronJob, skipSuspended, window)
+
+					return err == nil && due
+				}
+			}
+
+			return iis
+		},
+		resyncPeriod: resyncPeriod,
+	}
+
+	if window != nil {
+		opts.recomputeInterval = cronRecomputeInterval
+		opts.clock = window.clock
+	}
+
+	return NewInformerSource(opts)
+}
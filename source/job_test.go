@@ -0,0 +1,138 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func cronJobWithImages(name string, suspend bool, images ...string) batchv1.CronJob {
+	return batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "0 0 * * *",
+			Suspend:  &suspend,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: podTemplateWithImages(images...),
+				},
+			},
+		},
+	}
+}
+
+func Test_JobSource_Defaults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "default",
+		},
+		Spec: batchv1.JobSpec{
+			Template: podTemplateWithImages("alpine"),
+		},
+	}
+
+	cronJob := cronJobWithImages("cronjob", false, "debian")
+
+	fakeClient := fake.NewSimpleClientset(&job, &cronJob)
+	src := source.NewJobSource(fakeClient, time.Minute*15, "", true, nil)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_JobSource_SkipSuspended(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	activeCronJob := cronJobWithImages("cronjob-1", false, "alpine")
+	suspendedCronJob := cronJobWithImages("cronjob-2", true, "debian")
+
+	fakeClient := fake.NewSimpleClientset(&activeCronJob, &suspendedCronJob)
+	src := source.NewJobSource(fakeClient, time.Minute*15, "", true, nil)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine"})
+}
+
+func Test_JobSource_IncludeSuspended(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	activeCronJob := cronJobWithImages("cronjob-1", false, "alpine")
+	suspendedCronJob := cronJobWithImages("cronjob-2", true, "debian")
+
+	fakeClient := fake.NewSimpleClientset(&activeCronJob, &suspendedCronJob)
+	src := source.NewJobSource(fakeClient, time.Minute*15, "", false, nil)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_JobSource_Suspend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	cronJob := cronJobWithImages("cronjob", false, "alpine", "debian")
+
+	fakeClient := fake.NewSimpleClientset(&cronJob)
+	src := source.NewJobSource(fakeClient, time.Minute*15, "", true, nil)
+
+	go src.Run(ctx)
+
+	jobSource := src.(*source.InformerSource)
+
+	for !jobSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	suspend := true
+	cronJob.Spec.Suspend = &suspend
+
+	_, err := fakeClient.BatchV1().CronJobs("default").Update(ctx, &cronJob, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{})
+}
+
+func Test_JobSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewJobSource(fakeClient, time.Minute*15, "", true, nil)
+
+	assert.Equal(t, "Job", src.Name())
+}
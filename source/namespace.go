@@ -0,0 +1,297 @@
+package source
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceScope restricts the namespaces that namespaced sources watch, either to a fixed set of
+// namespaces, to the namespaces whose labels match a selector, or to both.  A nil scope watches every
+// namespace.
+type NamespaceScope struct {
+	namespaces map[string]bool
+	selector   labels.Selector
+	informer   cache.SharedIndexInformer
+}
+
+// NamespaceScopedSource is implemented by sources of namespaced resources that can be restricted to
+// a NamespaceScope
+type NamespaceScopedSource interface {
+	// SetNamespaceScope restricts the source to the namespaces of scope.  Must be called before Run.
+	SetNamespaceScope(scope *NamespaceScope)
+}
+
+// NewNamespaceScope creates a scope for the given namespaces and namespace label selector.  If
+// neither is given, nil is returned, which watches every namespace.  A scope with a selector must be
+// run with Run in order to observe Namespaces.
+func NewNamespaceScope(client kubernetes.Interface, namespaces []string, selector string) (*NamespaceScope, error) {
+	if len(namespaces) == 0 && selector == "" {
+		return nil, nil
+	}
+
+	scope := &NamespaceScope{
+		namespaces: make(map[string]bool),
+	}
+
+	for _, namespace := range namespaces {
+		scope.namespaces[namespace] = true
+	}
+
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+
+		if err != nil {
+			return nil, err
+		}
+
+		scope.selector = parsed
+
+		// Namespaces are matched against the selector locally, so that a Namespace whose labels stop
+		// matching is observed as an update rather than disappearing from the watch.
+		fac := informers.NewSharedInformerFactory(client, 0)
+		scope.informer = fac.Core().V1().Namespaces().Informer()
+	}
+
+	return scope, nil
+}
+
+func (s *NamespaceScope) Run(ctx context.Context) {
+	if s == nil || s.informer == nil {
+		return
+	}
+
+	s.informer.Run(ctx.Done())
+}
+
+func (s *NamespaceScope) HasSynced() bool {
+	if s == nil || s.informer == nil {
+		return true
+	}
+
+	return s.informer.HasSynced()
+}
+
+// Contains returns whether objects in namespace fall within the scope, without considering the
+// namespace selector.
+func (s *NamespaceScope) Contains(namespace string) bool {
+	return s == nil || len(s.namespaces) == 0 || s.namespaces[namespace]
+}
+
+func (s *NamespaceScope) matches(obj interface{}) (string, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	namespace, ok := obj.(*corev1.Namespace)
+
+	if !ok {
+		return "", false
+	}
+
+	return namespace.Name, s.Contains(namespace.Name) && s.selector.Matches(labels.Set(namespace.Labels))
+}
+
+// watch calls start for every namespace as it enters the scope, and stop as it leaves.  A nil scope
+// starts v1.NamespaceAll.
+func (s *NamespaceScope) watch(start func(namespace string), stop func(namespace string)) {
+	if s == nil {
+		start(v1.NamespaceAll)
+		return
+	}
+
+	if s.informer == nil {
+		for namespace := range s.namespaces {
+			start(namespace)
+		}
+
+		return
+	}
+
+	s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if namespace, ok := s.matches(obj); ok {
+				start(namespace)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			namespace, previous := s.matches(oldObj)
+			_, current := s.matches(newObj)
+
+			if current && !previous {
+				start(namespace)
+			} else if previous && !current {
+				stop(namespace)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if namespace, ok := s.matches(obj); ok {
+				stop(namespace)
+			}
+		},
+	})
+}
+
+// scopedNamespace holds the informers started for a single namespace
+type scopedNamespace struct {
+	namespace string
+	informers []imageInformer
+	cancel    context.CancelFunc
+}
+
+// scopedInformers runs the informers created by newInformers for every namespace of a NamespaceScope,
+// starting them as each namespace enters the scope and stopping them as it leaves.
+type scopedInformers struct {
+	scope        *NamespaceScope
+	newInformers func(namespace string) []imageInformer
+
+	// onStart, if set, is called with the informers of a namespace before they are run, and must not
+	// block.  onStop, if set, is called once the informers of a namespace have been stopped.
+	onStart func(sn *scopedNamespace)
+	onStop  func(namespace string)
+
+	lock       sync.RWMutex
+	wg         sync.WaitGroup
+	namespaces map[string]*scopedNamespace
+	started    bool
+	stopping   bool
+}
+
+func newScopedInformers() *scopedInformers {
+	return &scopedInformers{
+		namespaces: make(map[string]*scopedNamespace),
+	}
+}
+
+func (s *scopedInformers) start(ctx context.Context, namespace string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stopping || s.namespaces[namespace] != nil {
+		return
+	}
+
+	nsCtx, cancel := context.WithCancel(ctx)
+
+	sn := &scopedNamespace{
+		namespace: namespace,
+		informers: s.newInformers(namespace),
+		cancel:    cancel,
+	}
+
+	s.namespaces[namespace] = sn
+
+	if s.onStart != nil {
+		s.onStart(sn)
+	}
+
+	for _, ii := range sn.informers {
+		s.wg.Add(1)
+
+		go func(informer cache.SharedIndexInformer) {
+			defer s.wg.Done()
+			informer.Run(nsCtx.Done())
+		}(ii.informer)
+	}
+}
+
+func (s *scopedInformers) stop(namespace string) {
+	s.lock.Lock()
+	sn := s.namespaces[namespace]
+	delete(s.namespaces, namespace)
+	s.lock.Unlock()
+
+	if sn == nil {
+		return
+	}
+
+	sn.cancel()
+
+	if s.onStop != nil {
+		s.onStop(namespace)
+	}
+}
+
+// run blocks until ctx is cancelled and every informer that was started has stopped
+func (s *scopedInformers) run(ctx context.Context) {
+	s.scope.watch(func(namespace string) {
+		s.start(ctx, namespace)
+	}, s.stop)
+
+	s.lock.Lock()
+	s.started = true
+	s.lock.Unlock()
+
+	<-ctx.Done()
+
+	// Namespaces may be started until this point, after which the WaitGroup no longer grows
+	s.lock.Lock()
+	s.stopping = true
+	s.lock.Unlock()
+
+	s.wg.Wait()
+}
+
+// isActive returns whether sn is still running, since events may be delivered by its informers
+// for a short while after it is stopped
+func (s *scopedInformers) isActive(sn *scopedNamespace) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.namespaces[sn.namespace] == sn
+}
+
+// list returns the informers of every namespace that is currently running
+func (s *scopedInformers) list() []imageInformer {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var informers []imageInformer
+
+	for _, sn := range s.namespaces {
+		informers = append(informers, sn.informers...)
+	}
+
+	return informers
+}
+
+// forNamespace returns the informers holding the objects of namespace, or nil if it is not watched
+func (s *scopedInformers) forNamespace(namespace string) []imageInformer {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if sn, ok := s.namespaces[namespace]; ok {
+		return sn.informers
+	}
+
+	if sn, ok := s.namespaces[v1.NamespaceAll]; ok {
+		return sn.informers
+	}
+
+	return nil
+}
+
+func (s *scopedInformers) hasSynced() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if !s.started || !s.scope.HasSynced() {
+		return false
+	}
+
+	for _, sn := range s.namespaces {
+		for _, ii := range sn.informers {
+			if !ii.informer.HasSynced() {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,177 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func labelledNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func imageListConfigMap(namespace, name string, images ...string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "image-cache-daemon",
+			},
+		},
+		Data: map[string]string{
+			"images": marshalOrPanic(images),
+		},
+	}
+}
+
+func Test_NewNamespaceScope(t *testing.T) {
+	scope, err := source.NewNamespaceScope(fake.NewSimpleClientset(), nil, "")
+	assert.NoError(t, err)
+	assert.Nil(t, scope)
+	assert.True(t, scope.Contains("default"))
+
+	scope, err = source.NewNamespaceScope(fake.NewSimpleClientset(), []string{"team-a"}, "")
+	assert.NoError(t, err)
+	assert.True(t, scope.Contains("team-a"))
+	assert.False(t, scope.Contains("team-b"))
+
+	_, err = source.NewNamespaceScope(fake.NewSimpleClientset(), nil, "team in (a")
+	assert.Error(t, err)
+}
+
+func Test_NamespaceScope_Namespaces(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListConfigMap("team-a", "images", "alpine"),
+		imageListConfigMap("team-b", "images", "debian"),
+		imageListConfigMap("team-c", "images", "ubuntu"),
+	)
+
+	scope, err := source.NewNamespaceScope(fakeClient, []string{"team-a", "team-b"}, "")
+	assert.NoError(t, err)
+
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+	src.(source.NamespaceScopedSource).SetNamespaceScope(scope)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_NamespaceScope_Selector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		labelledNamespace("team-a", map[string]string{"cache": "true"}),
+		labelledNamespace("team-b", map[string]string{"cache": "true"}),
+		labelledNamespace("team-c", nil),
+		imageListConfigMap("team-a", "images", "alpine"),
+		imageListConfigMap("team-b", "images", "debian"),
+		imageListConfigMap("team-c", "images", "ubuntu"),
+	)
+
+	scope, err := source.NewNamespaceScope(fakeClient, nil, "cache=true")
+	assert.NoError(t, err)
+
+	go scope.Run(ctx)
+
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+	src.(source.NamespaceScopedSource).SetNamespaceScope(scope)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+
+	configMapSource := src.(*source.ConfigMapSource)
+
+	for !configMapSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// team-b leaves the scope, and team-c joins it
+	_, err = fakeClient.CoreV1().Namespaces().Update(ctx, labelledNamespace("team-b", nil), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	_, err = fakeClient.CoreV1().Namespaces().Update(ctx, labelledNamespace("team-c", map[string]string{"cache": "true"}), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "ubuntu"})
+}
+
+func Test_NamespaceScope_SelectorAndNamespaces(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		labelledNamespace("team-a", map[string]string{"cache": "true"}),
+		labelledNamespace("team-b", map[string]string{"cache": "true"}),
+		imageListConfigMap("team-a", "images", "alpine"),
+		imageListConfigMap("team-b", "images", "debian"),
+	)
+
+	scope, err := source.NewNamespaceScope(fakeClient, []string{"team-a"}, "cache=true")
+	assert.NoError(t, err)
+
+	go scope.Run(ctx)
+
+	src := source.NewConfigMapSource(fakeClient, time.Minute*15, source.WithConfigMapSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+	src.(source.NamespaceScopedSource).SetNamespaceScope(scope)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+}
+
+func Test_NamespaceScope_PodSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		runningPod("team-a", "pod-1", "nginx"),
+		runningPod("team-b", "pod-2", "redis"),
+	)
+
+	scope, err := source.NewNamespaceScope(fakeClient, []string{"team-a"}, "")
+	assert.NoError(t, err)
+
+	src := source.NewPodSource(fakeClient, time.Minute*15, 1, 0)
+	src.(source.NamespaceScopedSource).SetNamespaceScope(scope)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"nginx"})
+}
@@ -0,0 +1,116 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// PullPolicy controls whether an image is pulled again when the node may already have it
+type PullPolicy string
+
+const (
+	// PullAlways pulls the image every time it is requested, which refreshes mutable tags
+	PullAlways PullPolicy = "always"
+	// PullIfNotPresent only pulls the image if the node does not already have it
+	PullIfNotPresent PullPolicy = "if-not-present"
+)
+
+// ImageOptions describe where, when and whether an image is pulled.  The zero value pulls the image
+// to every node.
+type ImageOptions struct {
+	// NodeSelector restricts the nodes that pull the image
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Priority orders the image ahead of images with a lower priority while pulls are queued
+	Priority int32 `json:"priority,omitempty"`
+	// PullPolicy defaults to PullAlways
+	PullPolicy PullPolicy `json:"pullPolicy,omitempty"`
+	// Platforms restricts the image to nodes of the given <os>/<arch>[/<variant>] platforms
+	Platforms []string `json:"platforms,omitempty"`
+	// ExpiresAt, if set, is the time after which the image is no longer pulled
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ImageOptionsSource is implemented by sources that attach ImageOptions to the images they emit.
+// Images emitted by other sources are pulled with the zero value.
+type ImageOptionsSource interface {
+	// ImageOptions returns the options of every entry that requested image, since the same image
+	// may be requested more than once with different options.  It is called as events are received,
+	// so it must not wait on anything that is held while sending them.
+	ImageOptions(image string) []ImageOptions
+}
+
+// imageEntry is an element of an image list, which is either the name of an image or an object
+// holding the image along with its ImageOptions
+type imageEntry struct {
+	ImageOptions `json:",inline"`
+
+	Image string `json:"image"`
+}
+
+func (e *imageEntry) UnmarshalJSON(data []byte) error {
+	var image string
+
+	if err := json.Unmarshal(data, &image); err == nil {
+		*e = imageEntry{Image: image}
+		return nil
+	}
+
+	// The alias drops this method so that the object is decoded normally
+	type plainImageEntry imageEntry
+
+	var entry plainImageEntry
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fmt.Errorf("an image entry must be a string or an object: %v", err)
+	}
+
+	*e = imageEntry(entry)
+
+	return nil
+}
+
+func (e *imageEntry) validate() error {
+	if e.Image == "" {
+		return fmt.Errorf("an image entry must specify an image")
+	}
+
+	switch e.PullPolicy {
+	case "", PullAlways, PullIfNotPresent:
+	default:
+		return fmt.Errorf("image %s has unknown pullPolicy %q, must be %q or %q", e.Image, e.PullPolicy, PullAlways, PullIfNotPresent)
+	}
+
+	for _, platform := range e.Platforms {
+		if parts := strings.Split(platform, "/"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("image %s has invalid platform %q, must be of the form <os>/<arch>[/<variant>]", e.Image, platform)
+		}
+	}
+
+	return nil
+}
+
+// parseImageEntries parses a JSON or YAML list whose elements are either images or objects holding
+// an image and its options.  Images that are listed more than once keep every set of options.
+func parseImageEntries(value string) (map[string][]ImageOptions, error) {
+	var entries []imageEntry
+
+	if err := yaml.Unmarshal([]byte(value), &entries); err != nil {
+		return nil, err
+	}
+
+	options := make(map[string][]ImageOptions)
+
+	for idx := range entries {
+		if err := entries[idx].validate(); err != nil {
+			return nil, err
+		}
+
+		options[entries[idx].Image] = append(options[entries[idx].Image], entries[idx].ImageOptions)
+	}
+
+	return options, nil
+}
@@ -0,0 +1,260 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// pullPodSelector excludes the pods created by the pull strategy so that the daemon never
+// observes (and re-emits) the images it is currently pulling.
+const pullPodSelector = "part-of!=image-cache-daemon"
+
+// PodSource observes running pods across the cluster and emits an image once it is in use by
+// at least minPods pods or in at least minNamespaces namespaces.  When usage drops below both
+// thresholds, the image is withdrawn with an ImageRemoved event.
+type PodSource struct {
+	logger        *logrus.Logger
+	events        chan ImageEvent
+	resyncPeriod  time.Duration
+	minPods       int
+	minNamespaces int
+
+	informers *scopedInformers
+
+	// podImages is the set of images that each running pod (keyed by namespace/name) contributes
+	podImages map[string]map[string]bool
+	// imagePods is the set of running pods that use each image
+	imagePods map[string]map[string]bool
+	// imageNamespaces counts the running pods using each image per namespace
+	imageNamespaces map[string]map[string]int
+
+	imageMap map[string]bool
+	images   []string
+	lock     sync.RWMutex
+}
+
+func (ps *PodSource) Events() <-chan ImageEvent {
+	return ps.events
+}
+
+func (ps *PodSource) Images() []string {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.images
+}
+
+func (*PodSource) Name() string {
+	return "Pod"
+}
+
+func (ps *PodSource) HasSynced() bool {
+	return ps.informers.hasSynced()
+}
+
+// SetNamespaceScope restricts the pods that are observed to the namespaces of scope.  Must be called
+// before Run.
+func (ps *PodSource) SetNamespaceScope(scope *NamespaceScope) {
+	ps.informers.scope = scope
+}
+
+func getImagesFromRunningPod(obj interface{}) map[string]bool {
+	pod, ok := obj.(*corev1.Pod)
+
+	if !ok || pod.Status.Phase != corev1.PodRunning {
+		return map[string]bool{}
+	}
+
+	return getImageSetFromPodSpec(&pod.Spec)
+}
+
+func (ps *PodSource) isPopular(image string) bool {
+	if ps.minPods > 0 && len(ps.imagePods[image]) >= ps.minPods {
+		return true
+	}
+
+	if ps.minNamespaces > 0 && len(ps.imageNamespaces[image]) >= ps.minNamespaces {
+		return true
+	}
+
+	return false
+}
+
+// removeImage withdraws image on behalf of the pod identified by key
+func (ps *PodSource) removeImage(image string, key string) {
+	delete(ps.imageMap, image)
+	ps.events <- ImageEvent{Type: ImageRemoved, Image: image, Source: ps.Name(), Object: key}
+
+	for idx, i := range ps.images {
+		if i == image {
+			ps.images = append(ps.images[:idx], ps.images[idx+1:]...)
+			break
+		}
+	}
+}
+
+// setPodImages records the images used by the pod identified by key and emits or withdraws
+// any image whose popularity changed as a result.  Must be called with the lock held.
+func (ps *PodSource) setPodImages(key, namespace string, images map[string]bool) {
+	previousImages := ps.podImages[key]
+
+	if len(images) > 0 {
+		ps.podImages[key] = images
+	} else {
+		delete(ps.podImages, key)
+	}
+
+	for _, image := range setDifference(previousImages, images) {
+		delete(ps.imagePods[image], key)
+
+		if len(ps.imagePods[image]) == 0 {
+			delete(ps.imagePods, image)
+		}
+
+		ps.imageNamespaces[image][namespace]--
+
+		if ps.imageNamespaces[image][namespace] <= 0 {
+			delete(ps.imageNamespaces[image], namespace)
+		}
+
+		if len(ps.imageNamespaces[image]) == 0 {
+			delete(ps.imageNamespaces, image)
+		}
+
+		if ps.imageMap[image] && !ps.isPopular(image) {
+			ps.logger.WithField("image", image).Info("image is no longer popular, withdrawing")
+			ps.removeImage(image, key)
+		}
+	}
+
+	for _, image := range setDifference(images, previousImages) {
+		if _, ok := ps.imagePods[image]; !ok {
+			ps.imagePods[image] = make(map[string]bool)
+		}
+
+		if _, ok := ps.imageNamespaces[image]; !ok {
+			ps.imageNamespaces[image] = make(map[string]int)
+		}
+
+		ps.imagePods[image][key] = true
+		ps.imageNamespaces[image][namespace]++
+
+		if !ps.imageMap[image] && ps.isPopular(image) {
+			ps.imageMap[image] = true
+			ps.images = append(ps.images, image)
+			ps.events <- ImageEvent{Type: ImageAdded, Image: image, Source: ps.Name(), Object: key}
+		}
+	}
+}
+
+// handlePod records the images of a pod observed by the informers of sn
+func (ps *PodSource) handlePod(sn *scopedNamespace, obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	pod, ok := obj.(*corev1.Pod)
+
+	if !ok {
+		ps.logger.Errorf("could not cast input to corev1.Pod, got %T", obj)
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+
+	if err != nil {
+		ps.logger.Errorf("failed to get key for pod: %v", err)
+		return
+	}
+
+	images := map[string]bool{}
+
+	if !deleted {
+		images = getImagesFromRunningPod(pod)
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if !ps.informers.isActive(sn) {
+		return
+	}
+
+	ps.setPodImages(key, pod.Namespace, images)
+}
+
+// forgetNamespace withdraws the pods of a namespace that left the scope of the source
+func (ps *PodSource) forgetNamespace(namespace string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for key := range ps.podImages {
+		if podNamespace, _, err := cache.SplitMetaNamespaceKey(key); err == nil && podNamespace == namespace {
+			ps.setPodImages(key, namespace, map[string]bool{})
+		}
+	}
+}
+
+func (ps *PodSource) Run(ctx context.Context) {
+	ps.informers.onStart = func(sn *scopedNamespace) {
+		for _, ii := range sn.informers {
+			ii.informer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					ps.handlePod(sn, obj, false)
+				},
+				UpdateFunc: func(_, newObj interface{}) {
+					ps.handlePod(sn, newObj, false)
+				},
+				DeleteFunc: func(obj interface{}) {
+					ps.handlePod(sn, obj, true)
+				},
+			}, ps.resyncPeriod)
+		}
+	}
+
+	ps.informers.onStop = ps.forgetNamespace
+	ps.informers.run(ctx)
+
+	close(ps.events)
+}
+
+// NewPodSource creates a source that emits images used by at least minPods running pods or
+// found in at least minNamespaces namespaces.  A threshold of zero disables that criterion.
+func NewPodSource(client kubernetes.Interface, resyncPeriod time.Duration, minPods, minNamespaces int) ImageSource {
+	if minPods <= 0 && minNamespaces <= 0 {
+		minPods = 1
+	}
+
+	ps := &PodSource{
+		logger:          logrus.StandardLogger(),
+		events:          make(chan ImageEvent),
+		resyncPeriod:    resyncPeriod,
+		minPods:         minPods,
+		minNamespaces:   minNamespaces,
+		informers:       newScopedInformers(),
+		podImages:       make(map[string]map[string]bool),
+		imagePods:       make(map[string]map[string]bool),
+		imageNamespaces: make(map[string]map[string]int),
+		imageMap:        make(map[string]bool),
+		images:          make([]string, 0),
+		lock:            sync.RWMutex{},
+	}
+
+	ps.informers.newInformers = func(namespace string) []imageInformer {
+		fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+			lo.LabelSelector = pullPodSelector
+		}))
+
+		return newImageInformers(nil, fac.Core().V1().Pods().Informer())
+	}
+
+	return ps
+}
@@ -0,0 +1,143 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func runningPod(namespace, name string, images ...string) *corev1.Pod {
+	template := podTemplateWithImages(images...)
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: template.Spec,
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+}
+
+func Test_PodSource_MinPods(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		runningPod("default", "pod-1", "alpine", "debian"),
+		runningPod("default", "pod-2", "alpine"),
+		runningPod("other", "pod-3", "ubuntu"),
+	)
+
+	src := source.NewPodSource(fakeClient, time.Minute*15, 2, 0)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine"})
+}
+
+func Test_PodSource_MinNamespaces(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		runningPod("default", "pod-1", "alpine", "debian"),
+		runningPod("default", "pod-2", "alpine", "debian"),
+		runningPod("other", "pod-3", "debian"),
+	)
+
+	src := source.NewPodSource(fakeClient, time.Minute*15, 0, 2)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"debian"})
+}
+
+func Test_PodSource_IgnoresPullPodsAndPendingPods(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	pullPod := runningPod("image-cache-daemon", "pull-pod", "alpine")
+	pullPod.Labels = map[string]string{
+		"part-of": "image-cache-daemon",
+	}
+
+	pendingPod := runningPod("default", "pending-pod", "debian")
+	pendingPod.Status.Phase = corev1.PodPending
+
+	fakeClient := fake.NewSimpleClientset(pullPod, pendingPod, runningPod("default", "pod", "ubuntu"))
+
+	src := source.NewPodSource(fakeClient, time.Minute*15, 1, 0)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"ubuntu"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_PodSource_Withdraw(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	completedPod := runningPod("default", "pod-2", "alpine")
+
+	fakeClient := fake.NewSimpleClientset(
+		runningPod("default", "pod-1", "alpine", "debian"),
+		completedPod,
+		runningPod("default", "pod-3", "debian"),
+	)
+
+	src := source.NewPodSource(fakeClient, time.Minute*15, 2, 0)
+
+	go src.Run(ctx)
+
+	podSource := src.(*source.PodSource)
+
+	for !podSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	completedPod.Status.Phase = corev1.PodSucceeded
+
+	_, err := fakeClient.CoreV1().Pods("default").Update(ctx, completedPod, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	err = fakeClient.CoreV1().Pods("default").Delete(ctx, "pod-3", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{})
+}
+
+func Test_PodSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewPodSource(fakeClient, time.Minute*15, 2, 0)
+
+	assert.Equal(t, "Pod", src.Name())
+}
@@ -0,0 +1,597 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/benbjohnson/clock"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultRegistryHost = "registry-1.docker.io"
+	defaultTagCount     = 1
+)
+
+// RegistryTagRule selects the tags of a repository that should be pulled
+type RegistryTagRule struct {
+	// Repository is a repository such as "registry.example.com/base/python" or "alpine"
+	Repository string
+	// Constraint is a semver constraint such as "~1.4" that tags must satisfy
+	Constraint string
+	// Regex is a regular expression that tags must match
+	Regex string
+	// Count is how many of the newest matching tags are pulled
+	Count int
+}
+
+// ParseRegistryTagRule parses a rule of the form "repository=<repository>;semver=<constraint>;count=<n>",
+// where "regex=<regex>" may be given instead of, or in addition to, the semver constraint.
+func ParseRegistryTagRule(value string) (*RegistryTagRule, error) {
+	rule := &RegistryTagRule{
+		Count: defaultTagCount,
+	}
+
+	for _, field := range strings.Split(value, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("rule %q has a field %q that is not of the form <key>=<value>", value, field)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		switch key {
+		case "repository":
+			rule.Repository = val
+		case "semver":
+			rule.Constraint = val
+		case "regex":
+			rule.Regex = val
+		case "count":
+			count, err := strconv.Atoi(val)
+
+			if err != nil {
+				return nil, fmt.Errorf("rule %q has an invalid count: %v", value, err)
+			}
+
+			rule.Count = count
+		default:
+			return nil, fmt.Errorf("rule %q has an unknown field %q", value, key)
+		}
+	}
+
+	if _, err := newTagMatcher(rule); err != nil {
+		return nil, fmt.Errorf("rule %q is invalid: %v", value, err)
+	}
+
+	return rule, nil
+}
+
+// splitRepository returns the registry host and repository path of a repository, following the same
+// defaulting rules as docker.
+func splitRepository(repository string) (string, string) {
+	parts := strings.SplitN(repository, "/", 2)
+
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0], parts[1]
+	}
+
+	if len(parts) == 1 {
+		return defaultRegistryHost, "library/" + repository
+	}
+
+	return defaultRegistryHost, repository
+}
+
+type tagMatcher struct {
+	rule       *RegistryTagRule
+	constraint *semver.Constraints
+	regex      *regexp.Regexp
+}
+
+func newTagMatcher(rule *RegistryTagRule) (*tagMatcher, error) {
+	if rule.Repository == "" {
+		return nil, fmt.Errorf("a repository is required")
+	}
+
+	if rule.Constraint == "" && rule.Regex == "" {
+		return nil, fmt.Errorf("either a semver constraint or a regex is required")
+	}
+
+	if rule.Count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+
+	m := &tagMatcher{
+		rule: rule,
+	}
+
+	if rule.Constraint != "" {
+		constraint, err := semver.NewConstraint(rule.Constraint)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid semver constraint %q: %v", rule.Constraint, err)
+		}
+
+		m.constraint = constraint
+	}
+
+	if rule.Regex != "" {
+		regex, err := regexp.Compile(rule.Regex)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %v", rule.Regex, err)
+		}
+
+		m.regex = regex
+	}
+
+	return m, nil
+}
+
+// newestTags returns the newest Count tags that match the rule.  Tags that are valid semver versions
+// are ordered by version and always considered newer than those that are not, which are ordered
+// lexically.
+func (m *tagMatcher) newestTags(tags []string) []string {
+	type candidate struct {
+		tag     string
+		version *semver.Version
+	}
+
+	var candidates []candidate
+
+	for _, tag := range tags {
+		version, err := semver.NewVersion(tag)
+
+		if err != nil {
+			version = nil
+		}
+
+		if m.constraint != nil && (version == nil || !m.constraint.Check(version)) {
+			continue
+		}
+
+		if m.regex != nil && !m.regex.MatchString(tag) {
+			continue
+		}
+
+		candidates = append(candidates, candidate{tag: tag, version: version})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		if a.version != nil && b.version != nil {
+			if !a.version.Equal(b.version) {
+				return a.version.GreaterThan(b.version)
+			}
+
+			return a.tag > b.tag
+		}
+
+		if a.version != nil || b.version != nil {
+			return a.version != nil
+		}
+
+		return a.tag > b.tag
+	})
+
+	var newest []string
+
+	for idx := 0; idx < len(candidates) && idx < m.rule.Count; idx++ {
+		newest = append(newest, candidates[idx].tag)
+	}
+
+	return newest
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// registryCredentials returns the username and password for host, if any
+func registryCredentials(config *dockerConfigJSON, host string) (string, string) {
+	if config == nil {
+		return "", ""
+	}
+
+	keys := []string{host, "https://" + host, "http://" + host}
+
+	if host == defaultRegistryHost {
+		keys = append(keys, "docker.io", "index.docker.io", "https://index.docker.io/v1/")
+	}
+
+	for _, key := range keys {
+		entry, ok := config.Auths[key]
+
+		if !ok {
+			continue
+		}
+
+		if entry.Username != "" || entry.Password != "" {
+			return entry.Username, entry.Password
+		}
+
+		if decoded, err := base64.StdEncoding.DecodeString(entry.Auth); err == nil {
+			if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+				return parts[0], parts[1]
+			}
+		}
+	}
+
+	return "", ""
+}
+
+var challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseChallenge parses a WWW-Authenticate header into its scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	params := make(map[string]string)
+
+	if len(parts) == 2 {
+		for _, match := range challengeParamRegex.FindAllStringSubmatch(parts[1], -1) {
+			params[strings.ToLower(match[1])] = match[2]
+		}
+	}
+
+	return strings.ToLower(parts[0]), params
+}
+
+type RegistrySourceOpts struct {
+	Rules        []RegistryTagRule
+	PollInterval time.Duration
+
+	// Client and the Secret identified by SecretNamespace and SecretName provide registry credentials
+	// in the kubernetes.io/dockerconfigjson format.  Anonymous access is used when SecretName is empty.
+	Client          kubernetes.Interface
+	SecretNamespace string
+	SecretName      string
+
+	// HTTPClient, if set, is used to talk to registries
+	HTTPClient *http.Client
+}
+
+// RegistrySource lists the tags of repositories using the OCI distribution API and emits the newest
+// tags matching each rule.  Tags that are no longer among the newest are retracted.
+type RegistrySource struct {
+	matchers        []*tagMatcher
+	pollInterval    time.Duration
+	client          kubernetes.Interface
+	secretNamespace string
+	secretName      string
+	httpClient      *http.Client
+	clock           clock.Clock
+	logger          *logrus.Logger
+	events          chan ImageEvent
+
+	// ruleImages holds the images most recently selected by each rule
+	ruleImages []map[string]bool
+	imageMap   map[string]bool
+	images     []string
+	lock       sync.RWMutex
+}
+
+func NewRegistrySource(opts *RegistrySourceOpts) (ImageSource, error) {
+	if opts.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be greater than zero")
+	}
+
+	httpClient := opts.HTTPClient
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * 30}
+	}
+
+	rs := &RegistrySource{
+		pollInterval:    opts.PollInterval,
+		client:          opts.Client,
+		secretNamespace: opts.SecretNamespace,
+		secretName:      opts.SecretName,
+		httpClient:      httpClient,
+		clock:           clock.New(),
+		logger:          logrus.StandardLogger(),
+		events:          make(chan ImageEvent),
+		imageMap:        make(map[string]bool),
+		images:          make([]string, 0),
+	}
+
+	for idx := range opts.Rules {
+		m, err := newTagMatcher(&opts.Rules[idx])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule for %s: %v", opts.Rules[idx].Repository, err)
+		}
+
+		rs.matchers = append(rs.matchers, m)
+		rs.ruleImages = append(rs.ruleImages, make(map[string]bool))
+	}
+
+	return rs, nil
+}
+
+func (rs *RegistrySource) Events() <-chan ImageEvent {
+	return rs.events
+}
+
+func (rs *RegistrySource) Images() []string {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	return rs.images
+}
+
+func (*RegistrySource) Name() string {
+	return "RegistryTags"
+}
+
+func (rs *RegistrySource) getDockerConfig(ctx context.Context) (*dockerConfigJSON, error) {
+	if rs.client == nil || rs.secretName == "" {
+		return nil, nil
+	}
+
+	secret, err := rs.client.CoreV1().Secrets(rs.secretNamespace).Get(ctx, rs.secretName, v1.GetOptions{})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %v", rs.secretNamespace, rs.secretName, err)
+	}
+
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %s key", rs.secretNamespace, rs.secretName, corev1.DockerConfigJsonKey)
+	}
+
+	config := &dockerConfigJSON{}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret %s/%s: %v", rs.secretNamespace, rs.secretName, err)
+	}
+
+	return config, nil
+}
+
+// getToken exchanges credentials for a bearer token as described by a Bearer challenge
+func (rs *RegistrySource) getToken(ctx context.Context, params map[string]string, username, password string) (string, error) {
+	tokenURL, err := url.Parse(params["realm"])
+
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+
+	query := tokenURL.Query()
+
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+
+	if scope, ok := params["scope"]; ok {
+		query.Set("scope", scope)
+	}
+
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := rs.httpClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s from token endpoint", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token: %v", err)
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	return token.AccessToken, nil
+}
+
+// listTags returns every tag of repository, following pagination and authenticating as requested by
+// the registry.
+func (rs *RegistrySource) listTags(ctx context.Context, repository string, config *dockerConfigJSON) ([]string, error) {
+	host, name := splitRepository(repository)
+	username, password := registryCredentials(config, host)
+
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list", host, name)
+	authorization := ""
+
+	var tags []string
+
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := rs.httpClient.Do(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && authorization == "" {
+			resp.Body.Close()
+
+			scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+
+			switch scheme {
+			case "bearer":
+				token, err := rs.getToken(ctx, params, username, password)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to authenticate to %s: %v", host, err)
+				}
+
+				authorization = "Bearer " + token
+			case "basic":
+				authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+			default:
+				return nil, fmt.Errorf("unsupported authentication scheme %q from %s", scheme, host)
+			}
+
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %s listing tags of %s", resp.Status, repository)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tags of %s: %v", repository, err)
+		}
+
+		tags = append(tags, page.Tags...)
+		next = ""
+
+		if link := resp.Header.Get("Link"); link != "" {
+			start, end := strings.Index(link, "<"), strings.Index(link, ">")
+
+			if start != -1 && end > start && strings.Contains(link[end:], `rel="next"`) {
+				nextURL, err := resp.Request.URL.Parse(link[start+1 : end])
+
+				if err != nil {
+					return nil, fmt.Errorf("invalid link header %q: %v", link, err)
+				}
+
+				next = nextURL.String()
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+func (rs *RegistrySource) poll(ctx context.Context) {
+	config, err := rs.getDockerConfig(ctx)
+
+	if err != nil {
+		rs.logger.Errorf("failed to get registry credentials, continuing anonymously: %v", err)
+	}
+
+	ruleImages := make([]map[string]bool, len(rs.matchers))
+
+	for idx, m := range rs.matchers {
+		tags, err := rs.listTags(ctx, m.rule.Repository, config)
+
+		if err != nil {
+			if ctx.Err() == nil {
+				rs.logger.Errorf("failed to list tags, keeping the previous tags: %v", err)
+			}
+
+			rs.lock.RLock()
+			ruleImages[idx] = rs.ruleImages[idx]
+			rs.lock.RUnlock()
+
+			continue
+		}
+
+		ruleImages[idx] = make(map[string]bool)
+
+		for _, tag := range m.newestTags(tags) {
+			ruleImages[idx][fmt.Sprintf("%s:%s", m.rule.Repository, tag)] = true
+		}
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.ruleImages = ruleImages
+
+	currentImages := make(map[string]bool)
+
+	for _, images := range ruleImages {
+		for image := range images {
+			currentImages[image] = true
+		}
+	}
+
+	emitImageChanges(rs.events, rs.Name(), "", rs.imageMap, currentImages)
+
+	rs.imageMap = currentImages
+
+	var images []string
+
+	for image := range currentImages {
+		images = append(images, image)
+	}
+
+	rs.images = images
+}
+
+func (rs *RegistrySource) Run(ctx context.Context) {
+	defer close(rs.events)
+
+	ticker := rs.clock.Ticker(rs.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		rs.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
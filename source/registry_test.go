@@ -0,0 +1,256 @@
+package source_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// fakeRegistry implements enough of the distribution API to list tags, requiring a bearer token
+// obtained with basic credentials and paginating results.
+type fakeRegistry struct {
+	server   *httptest.Server
+	lock     sync.Mutex
+	tags     map[string][]string
+	username string
+	password string
+	pageSize int
+}
+
+func newFakeRegistry(t *testing.T, tags map[string][]string) *fakeRegistry {
+	r := &fakeRegistry{
+		tags:     tags,
+		username: "robot",
+		password: "hunter2",
+		pageSize: 2,
+	}
+
+	r.server = httptest.NewTLSServer(r)
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "https://")
+}
+
+func (r *fakeRegistry) setTags(name string, tags ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.tags[name] = tags
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if req.URL.Path == "/token" {
+		if username, password, ok := req.BasicAuth(); !ok || username != r.username || password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:pull"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v2/"), "/tags/list")
+	tags, ok := r.tags[name]
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	start, _ := strconv.Atoi(req.URL.Query().Get("last"))
+	end := start + r.pageSize
+
+	if end < len(tags) {
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%d>; rel="next"`, name, r.pageSize, end))
+	} else {
+		end = len(tags)
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "tags": tags[start:end]})
+}
+
+func (r *fakeRegistry) pullSecret() *corev1.Secret {
+	config := fmt.Sprintf(`{"auths": {"%s": {"username": "%s", "password": "%s"}}}`, r.host(), r.username, r.password)
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "registry-credentials",
+			Namespace: "image-cache-daemon",
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(config),
+		},
+	}
+}
+
+func Test_ParseRegistryTagRule(t *testing.T) {
+	rule, err := source.ParseRegistryTagRule("repository=registry.example.com/base/python;semver=~1.4;count=3")
+	assert.NoError(t, err)
+	assert.Equal(t, &source.RegistryTagRule{Repository: "registry.example.com/base/python", Constraint: "~1.4", Count: 3}, rule)
+
+	rule, err = source.ParseRegistryTagRule(`repository=alpine;regex=^3\.\d+$`)
+	assert.NoError(t, err)
+	assert.Equal(t, &source.RegistryTagRule{Repository: "alpine", Regex: `^3\.\d+$`, Count: 1}, rule)
+
+	for _, invalid := range []string{
+		"repository=alpine",
+		"semver=~1.4",
+		"repository=alpine;semver=~1.4;count=0",
+		"repository=alpine;semver=not a constraint",
+		"repository=alpine;regex=(",
+		"repository=alpine;semver=~1.4;tag=latest",
+	} {
+		_, err := source.ParseRegistryTagRule(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func Test_RegistrySource_Semver(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	registry := newFakeRegistry(t, map[string][]string{
+		"base/python": {"1.3.9", "1.4.0", "1.4.1", "v1.4.2", "1.4.3-rc.1", "1.5.0", "latest"},
+	})
+
+	repository := registry.host() + "/base/python"
+
+	src, err := source.NewRegistrySource(&source.RegistrySourceOpts{
+		Rules:           []source.RegistryTagRule{{Repository: repository, Constraint: "~1.4", Count: 2}},
+		PollInterval:    time.Minute,
+		Client:          fake.NewSimpleClientset(registry.pullSecret()),
+		SecretNamespace: "image-cache-daemon",
+		SecretName:      "registry-credentials",
+		HTTPClient:      registry.server.Client(),
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{repository + ":v1.4.2", repository + ":1.4.1"})
+	assert.ElementsMatch(t, src.Images(), []string{repository + ":v1.4.2", repository + ":1.4.1"})
+}
+
+func Test_RegistrySource_Regex(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	registry := newFakeRegistry(t, map[string][]string{
+		"base/node": {"16-slim", "16", "17-slim", "18-slim", "latest"},
+	})
+
+	repository := registry.host() + "/base/node"
+
+	src, err := source.NewRegistrySource(&source.RegistrySourceOpts{
+		Rules:           []source.RegistryTagRule{{Repository: repository, Regex: `-slim$`, Count: 2}},
+		PollInterval:    time.Minute,
+		Client:          fake.NewSimpleClientset(registry.pullSecret()),
+		SecretNamespace: "image-cache-daemon",
+		SecretName:      "registry-credentials",
+		HTTPClient:      registry.server.Client(),
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{repository + ":18-slim", repository + ":17-slim"})
+}
+
+func Test_RegistrySource_Retract(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	registry := newFakeRegistry(t, map[string][]string{
+		"base/python": {"1.4.0", "1.4.1"},
+	})
+
+	repository := registry.host() + "/base/python"
+
+	src, err := source.NewRegistrySource(&source.RegistrySourceOpts{
+		Rules:           []source.RegistryTagRule{{Repository: repository, Constraint: "~1.4", Count: 2}},
+		PollInterval:    time.Millisecond * 100,
+		Client:          fake.NewSimpleClientset(registry.pullSecret()),
+		SecretNamespace: "image-cache-daemon",
+		SecretName:      "registry-credentials",
+		HTTPClient:      registry.server.Client(),
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	var received []string
+
+	received = append(received, (<-src.Events()).Image, (<-src.Events()).Image)
+
+	registry.setTags("base/python", "1.4.0", "1.4.1", "1.4.2")
+
+	received = append(received, addedImages(src)...)
+
+	assert.ElementsMatch(t, received, []string{repository + ":1.4.0", repository + ":1.4.1", repository + ":1.4.2"})
+	assert.ElementsMatch(t, src.Images(), []string{repository + ":1.4.1", repository + ":1.4.2"})
+}
+
+func Test_RegistrySource_Unauthorized(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	registry := newFakeRegistry(t, map[string][]string{
+		"base/python": {"1.4.0"},
+	})
+
+	src, err := source.NewRegistrySource(&source.RegistrySourceOpts{
+		Rules:        []source.RegistryTagRule{{Repository: registry.host() + "/base/python", Constraint: "~1.4", Count: 1}},
+		PollInterval: time.Minute,
+		HTTPClient:   registry.server.Client(),
+	})
+	assert.NoError(t, err)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.Empty(t, received)
+}
+
+func Test_RegistrySource_Name(t *testing.T) {
+	src, err := source.NewRegistrySource(&source.RegistrySourceOpts{PollInterval: time.Minute})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "RegistryTags", src.Name())
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+type SecretOptFn func(ss *SecretSource)
+
+func WithSecretLogger(logger *logrus.Logger) SecretOptFn {
+	return func(ss *SecretSource) {
+		ss.logger = logger
+	}
+}
+
+func WithSecretSelector(selector string) SecretOptFn {
+	return func(ss *SecretSource) {
+		ss.secretSelector = selector
+	}
+}
+
+// WithSecretNamespace restricts the Secrets that are watched to a single namespace
+func WithSecretNamespace(namespace string) SecretOptFn {
+	return func(ss *SecretSource) {
+		ss.namespace = namespace
+	}
+}
+
+func getImagesFromSecret(obj interface{}) (map[string]bool, error) {
+	secret, ok := obj.(*corev1.Secret)
+
+	if !ok {
+		return nil, fmt.Errorf("could not cast input to corev1.Secret")
+	}
+
+	imagesKey := imagesKeyFromAnnotations(secret.Annotations)
+	imagesBytes, ok := secret.Data[imagesKey]
+
+	if !ok {
+		return make(map[string]bool), nil
+	}
+
+	imageMap, err := parseImageList(string(imagesBytes))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key %s in secret %s/%s: %v", imagesKey, secret.Namespace, secret.Name, err)
+	}
+
+	return imageMap, nil
+}
+
+// SecretSource emits the images listed in every Secret matching its selector.  It behaves like
+// ConfigMapSource, for image lists that should not be readable by everyone that can read ConfigMaps,
+// except that entries may only be image names.
+type SecretSource struct {
+	*InformerSource
+
+	secretSelector string
+	namespace      string
+	logger         *logrus.Logger
+	client         kubernetes.Interface
+}
+
+func NewSecretSource(client kubernetes.Interface, resyncPeriod time.Duration, opts ...SecretOptFn) ImageSource {
+	ss := &SecretSource{
+		client:    client,
+		logger:    logrus.StandardLogger(),
+		namespace: v1.NamespaceAll,
+	}
+
+	for _, fn := range opts {
+		fn(ss)
+	}
+
+	selector := fields.ParseSelectorOrDie(ss.secretSelector).String()
+
+	newInformers := func(namespace string) []imageInformer {
+		fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+			lo.LabelSelector = selector
+		}))
+
+		return newImageInformers(getImagesFromSecret, fac.Core().V1().Secrets().Informer())
+	}
+
+	ss.InformerSource = NewInformerSource(&InformerSourceOpts{
+		sourceName:   "Secret",
+		resyncPeriod: resyncPeriod,
+		logger:       ss.logger,
+	})
+
+	// An explicit namespace takes precedence over any NamespaceScope
+	if ss.namespace != v1.NamespaceAll {
+		ss.informers = newInformers(ss.namespace)
+	} else {
+		ss.namespacedInformers = newInformers
+	}
+
+	return ss
+}
@@ -0,0 +1,204 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func imageListSecret(namespace, name string, labels, annotations map[string]string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Data: make(map[string][]byte),
+	}
+
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+
+	return secret
+}
+
+var partOfImageCacheDaemon = map[string]string{
+	"app.kubernetes.io/part-of": "image-cache-daemon",
+}
+
+func Test_SecretSource_Defaults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListSecret("default", "secret-1", partOfImageCacheDaemon, nil, map[string]string{
+			"images": marshalOrPanic([]string{"alpine", "debian"}),
+		}),
+		imageListSecret("default", "secret-2", nil, nil, map[string]string{
+			"images": marshalOrPanic([]string{"ubuntu"}),
+		}),
+	)
+
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_SecretSource_Key_Annotation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListSecret("default", "secret-1", partOfImageCacheDaemon, map[string]string{
+			"image-cache-daemon/key": "internal-images",
+		}, map[string]string{
+			"images":          marshalOrPanic([]string{"alpine"}),
+			"internal-images": marshalOrPanic([]string{"registry.example.com/project-x"}),
+		}),
+	)
+
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"registry.example.com/project-x"})
+}
+
+func Test_SecretSource_Namespace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListSecret("image-cache-daemon", "secret-1", partOfImageCacheDaemon, nil, map[string]string{
+			"images": marshalOrPanic([]string{"alpine"}),
+		}),
+		imageListSecret("default", "secret-2", partOfImageCacheDaemon, nil, map[string]string{
+			"images": marshalOrPanic([]string{"ubuntu"}),
+		}),
+	)
+
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretSelector("app.kubernetes.io/part-of=image-cache-daemon"), source.WithSecretNamespace("image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+}
+
+func Test_SecretSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	secret := imageListSecret("default", "secret-1", partOfImageCacheDaemon, nil, map[string]string{
+		"images": marshalOrPanic([]string{"alpine", "debian"}),
+	})
+
+	fakeClient := fake.NewSimpleClientset(secret)
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	secretSource := src.(*source.SecretSource)
+
+	for !secretSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	secret.Data["images"] = []byte(marshalOrPanic([]string{"alpine", "centos"}))
+
+	_, err := fakeClient.CoreV1().Secrets("default").Update(ctx, secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "centos"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "centos"})
+}
+
+func Test_SecretSource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListSecret("default", "secret-1", partOfImageCacheDaemon, nil, map[string]string{
+			"images": marshalOrPanic([]string{"alpine", "debian"}),
+		}),
+		imageListSecret("default", "secret-2", partOfImageCacheDaemon, nil, map[string]string{
+			"images": marshalOrPanic([]string{"debian", "ubuntu"}),
+		}),
+	)
+
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretSelector("app.kubernetes.io/part-of=image-cache-daemon"))
+
+	go src.Run(ctx)
+
+	secretSource := src.(*source.SecretSource)
+
+	for !secretSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err := fakeClient.CoreV1().Secrets("default").Delete(ctx, "secret-2", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_SecretSource_Bad_Input(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	t.Cleanup(cancel)
+
+	logger, hook := test.NewNullLogger()
+
+	fakeClient := fake.NewSimpleClientset(
+		imageListSecret("default", "secret-1", partOfImageCacheDaemon, nil, map[string]string{
+			"images": "][",
+		}),
+	)
+
+	src := source.NewSecretSource(fakeClient, time.Minute*15, source.WithSecretLogger(logger))
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+
+	assert.Len(t, received, 0)
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_SecretSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewSecretSource(fakeClient, time.Minute*15)
+	assert.Equal(t, "Secret", src.Name())
+}
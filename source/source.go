@@ -4,8 +4,34 @@ import (
 	"context"
 )
 
+// ImageEventType describes how the images of a source changed
+type ImageEventType string
+
+const (
+	// ImageAdded is emitted when an image becomes part of the images of a source
+	ImageAdded ImageEventType = "Added"
+	// ImageRemoved is emitted when an image is no longer part of the images of a source
+	ImageRemoved ImageEventType = "Removed"
+	// ImageResync is emitted for an image that a source already holds when it should be pulled again
+	ImageResync ImageEventType = "Resync"
+)
+
+// ImageEvent is a change to the images of a source
+type ImageEvent struct {
+	Type  ImageEventType
+	Image string
+	// Source is the Name of the source that emitted the event
+	Source string
+	// Object is the key of the object whose addition, change or deletion caused the event, for sources
+	// that watch objects.  It is empty for the images of lists, and for images that were recomputed
+	// because time passed or the namespace scope changed rather than because of a single object.
+	Object string
+}
+
 type ImageSource interface {
-	ImageCh() <-chan string
+	// Events returns the channel on which the changes to Images are emitted, which is closed once
+	// Run returns
+	Events() <-chan ImageEvent
 	Images() []string
 	Name() string
 	Run(context.Context)
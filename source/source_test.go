@@ -0,0 +1,29 @@
+package source_test
+
+import (
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+// addedImages returns the image of every Added event emitted by src until its events are closed
+func addedImages(src source.ImageSource) []string {
+	var images []string
+
+	for event := range src.Events() {
+		if event.Type == source.ImageAdded {
+			images = append(images, event.Image)
+		}
+	}
+
+	return images
+}
+
+// imageEvents returns every event emitted by src until its events are closed
+func imageEvents(src source.ImageSource) []source.ImageEvent {
+	var events []source.ImageEvent
+
+	for event := range src.Events() {
+		events = append(events, event)
+	}
+
+	return events
+}
@@ -10,7 +10,7 @@ import (
 type StaticImageSource struct {
 	resyncPeriod time.Duration
 	images       []string
-	imageCh      chan string
+	events       chan ImageEvent
 	clock        clock.Clock
 }
 
@@ -18,8 +18,8 @@ func (StaticImageSource) Name() string {
 	return "static"
 }
 
-func (sis *StaticImageSource) ImageCh() <-chan string {
-	return sis.imageCh
+func (sis *StaticImageSource) Events() <-chan ImageEvent {
+	return sis.events
 }
 
 func (sis *StaticImageSource) Images() []string {
@@ -27,11 +27,16 @@ func (sis *StaticImageSource) Images() []string {
 }
 
 func (sis *StaticImageSource) Run(ctx context.Context) {
+	eventType := ImageAdded
+
 	for {
 		for _, i := range sis.images {
-			sis.imageCh <- i
+			sis.events <- ImageEvent{Type: eventType, Image: i, Source: sis.Name()}
 		}
 
+		// The images never change, so every later pass asks for them to be pulled again
+		eventType = ImageResync
+
 		if sis.resyncPeriod == 0 {
 			break
 		}
@@ -39,12 +44,12 @@ func (sis *StaticImageSource) Run(ctx context.Context) {
 		sis.clock.Sleep(sis.resyncPeriod)
 	}
 
-	close(sis.imageCh)
+	close(sis.events)
 }
 
 func NewStaticImageSource(images []string, resyncPeriod time.Duration) ImageSource {
 	return &StaticImageSource{
-		imageCh:      make(chan string),
+		events:       make(chan ImageEvent),
 		images:       images,
 		clock:        clock.New(),
 		resyncPeriod: resyncPeriod,
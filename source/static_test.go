@@ -27,8 +27,9 @@ func Test_StaticImageSource(t *testing.T) {
 
 	var emitted []string
 
-	for image := range src.ImageCh() {
-		emitted = append(emitted, image)
+	for event := range src.Events() {
+		assert.Equal(t, ImageAdded, event.Type)
+		emitted = append(emitted, event.Image)
 	}
 
 	time.Sleep(time.Millisecond * 10)
@@ -56,14 +57,16 @@ func Test_StaticImageSourceWithResync(t *testing.T) {
 	wg.Add(3)
 
 	var emitted []string
+	var eventTypes []ImageEventType
 
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case image := <-src.ImageCh():
-				emitted = append(emitted, image)
+			case event := <-src.Events():
+				emitted = append(emitted, event.Image)
+				eventTypes = append(eventTypes, event.Type)
 				wg.Done()
 			}
 		}
@@ -78,4 +81,7 @@ func Test_StaticImageSourceWithResync(t *testing.T) {
 	wg.Wait()
 
 	assert.EqualValues(t, emitted, []string{"foo", "bar", "baz", "foo", "bar", "baz"})
+
+	// Only the first pass adds the images, while every later one asks for them to be pulled again
+	assert.EqualValues(t, eventTypes, []ImageEventType{ImageAdded, ImageAdded, ImageAdded, ImageResync, ImageResync, ImageResync})
 }
@@ -1,35 +1,206 @@
 package source
 
 import (
+	"fmt"
+	"strings"
+
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
 )
 
-func getImageSetFromTemplates(templates []argov1alpha1.Template) map[string]bool {
-	imageMap := make(map[string]bool)
+func getImagesFromTemplate(t *argov1alpha1.Template) []string {
+	var images []string
+
+	for _, ic := range t.InitContainers {
+		images = append(images, ic.Container.Image)
+	}
 
-	for _, t := range templates {
-		for _, ic := range t.InitContainers {
-			imageMap[ic.Container.Image] = true
+	for _, sc := range t.Sidecars {
+		images = append(images, sc.Container.Image)
+	}
+
+	if t.Script != nil {
+		images = append(images, t.Script.Image)
+	}
+
+	if t.Container != nil {
+		images = append(images, t.Container.Image)
+	}
+
+	if t.ContainerSet != nil {
+		for _, c := range t.ContainerSet.Containers {
+			images = append(images, c.Image)
 		}
+	}
+
+	if t.Resource != nil && t.Resource.Manifest != "" {
+		manifestImages, err := getImagesFromManifest(t.Resource.Manifest)
 
-		if t.Script != nil {
-			imageMap[t.Script.Image] = true
+		// Manifests commonly contain {{...}} expressions that only parse once the workflow runs, and
+		// templates are re-extracted on every recompute and resync, so this is not worth a warning
+		if err != nil {
+			logrus.Debugf("failed to get images from resource template %s: %v", t.Name, err)
 		}
 
-		if t.Container != nil {
-			imageMap[t.Container.Image] = true
+		images = append(images, manifestImages...)
+	}
+
+	return images
+}
+
+// getImagesFromManifest returns the images of any pod spec found in a Kubernetes manifest.  Manifests
+// for kinds that do not contain a pod spec are ignored.
+func getImagesFromManifest(manifest string) ([]string, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode([]byte(manifest), nil, nil)
+
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) {
+			return nil, nil
 		}
 
-		if t.ContainerSet != nil {
-			for _, c := range t.ContainerSet.Containers {
-				imageMap[c.Image] = true
+		return nil, err
+	}
+
+	var imageMap map[string]bool
+
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		imageMap = getImageSetFromPodSpec(&o.Spec)
+	case *batchv1.Job, *batchv1.CronJob:
+		imageMap, err = getImagesFromJobFn(false, nil)(o)
+	case *appsv1.Deployment, *appsv1.StatefulSet, *appsv1.DaemonSet, *appsv1.ReplicaSet:
+		imageMap, err = getImagesFromWorkload(o)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+
+	for image := range imageMap {
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// expandInlineTemplates returns templates along with every template defined inline within their
+// steps and DAG tasks, however deeply nested.
+func expandInlineTemplates(templates []argov1alpha1.Template) []argov1alpha1.Template {
+	var expanded []argov1alpha1.Template
+
+	var visit func(t *argov1alpha1.Template)
+
+	visit = func(t *argov1alpha1.Template) {
+		expanded = append(expanded, *t)
+
+		for _, parallelSteps := range t.Steps {
+			for _, step := range parallelSteps.Steps {
+				if step.Inline != nil {
+					visit(step.Inline)
+				}
+			}
+		}
+
+		if t.DAG != nil {
+			for _, task := range t.DAG.Tasks {
+				if task.Inline != nil {
+					visit(task.Inline)
+				}
+			}
+		}
+	}
+
+	for idx := range templates {
+		visit(&templates[idx])
+	}
+
+	return expanded
+}
+
+// getImageSetFromTemplates returns the images used by templates after substituting any parameter
+// references, along with the images that could not be fully resolved.
+func getImageSetFromTemplates(templates []argov1alpha1.Template, workflowParameters []argov1alpha1.Parameter) (map[string]bool, []string) {
+	imageMap := make(map[string]bool)
+	var unresolved []string
+
+	templates = expandInlineTemplates(templates)
+
+	for idx := range templates {
+		t := &templates[idx]
+		var lookup map[string][]string
+
+		for _, image := range getImagesFromTemplate(t) {
+			if !templateTagRegex.MatchString(image) {
+				imageMap[image] = true
+				continue
+			}
+
+			if lookup == nil {
+				lookup = newParameterLookup(workflowParameters, t)
+			}
+
+			substituted, ok := substituteParameters(image, lookup, 0)
+
+			if !ok {
+				unresolved = append(unresolved, image)
+				continue
+			}
+
+			for _, i := range substituted {
+				imageMap[i] = true
 			}
 		}
 	}
 
+	return imageMap, unresolved
+}
+
+func getImageSetFromPodSpec(spec *corev1.PodSpec) map[string]bool {
+	imageMap := make(map[string]bool)
+
+	for _, c := range spec.InitContainers {
+		if c.Image != "" {
+			imageMap[c.Image] = true
+		}
+	}
+
+	for _, c := range spec.Containers {
+		if c.Image != "" {
+			imageMap[c.Image] = true
+		}
+	}
+
+	for _, c := range spec.EphemeralContainers {
+		if c.Image != "" {
+			imageMap[c.Image] = true
+		}
+	}
+
 	return imageMap
 }
 
+func namespaceOf(obj interface{}) string {
+	accessor, err := meta.Accessor(obj)
+
+	if err != nil {
+		return ""
+	}
+
+	return accessor.GetNamespace()
+}
+
 func setDifference(a map[string]bool, b map[string]bool) []string {
 	var results []string
 
@@ -41,3 +212,75 @@ func setDifference(a map[string]bool, b map[string]bool) []string {
 
 	return results
 }
+
+// emitImageChanges emits an Added event for every image of current that is not in previous, and a
+// Removed event for every image of previous that is not in current, on behalf of object if the change
+// was caused by a single object
+func emitImageChanges(events chan<- ImageEvent, sourceName string, object string, previous, current map[string]bool) {
+	for _, image := range setDifference(current, previous) {
+		events <- ImageEvent{Type: ImageAdded, Image: image, Source: sourceName, Object: object}
+	}
+
+	for _, image := range setDifference(previous, current) {
+		events <- ImageEvent{Type: ImageRemoved, Image: image, Source: sourceName, Object: object}
+	}
+}
+
+// isResync returns whether an update is the periodic resync of an informer rather than a change,
+// in which case both objects have the same resourceVersion
+func isResync(oldObj, newObj interface{}) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+
+	if err != nil {
+		return false
+	}
+
+	newMeta, err := meta.Accessor(newObj)
+
+	if err != nil {
+		return false
+	}
+
+	return newMeta.GetResourceVersion() != "" && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
+// parseImageList parses a JSON or YAML list of image names.  Lists whose entries may hold ImageOptions
+// are parsed by parseImageEntries instead.
+func parseImageList(value string) (map[string]bool, error) {
+	var images []string
+
+	if err := yaml.Unmarshal([]byte(value), &images); err != nil {
+		return nil, err
+	}
+
+	imageMap := make(map[string]bool)
+
+	for _, i := range images {
+		imageMap[i] = true
+	}
+
+	return imageMap, nil
+}
+
+// ParseGroupVersionResource parses a resource of the form "<group>/<version>/<resource>", such as
+// "apps/v1/deployments".  The group is omitted for core resources, as in "v1/services".
+func ParseGroupVersionResource(value string) (schema.GroupVersionResource, error) {
+	var gvr schema.GroupVersionResource
+
+	parts := strings.Split(value, "/")
+
+	switch len(parts) {
+	case 2:
+		gvr = schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}
+	case 3:
+		gvr = schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}
+	default:
+		return gvr, fmt.Errorf("resource %q must be of the form <group>/<version>/<resource>", value)
+	}
+
+	if gvr.Version == "" || gvr.Resource == "" {
+		return gvr, fmt.Errorf("resource %q must specify both a version and a resource", value)
+	}
+
+	return gvr, nil
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	argoclientset "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
+	argoinformers "github.com/argoproj/argo-workflows/v3/pkg/client/informers/externalversions"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The workflow controller labels workflows with this once they have completed, so filtering on it
+// keeps finished workflows out of the informer cache entirely.
+const incompleteWorkflowSelector = "workflows.argoproj.io/completed!=true"
+
+func isWorkflowInFlight(wf *argov1alpha1.Workflow) bool {
+	switch wf.Status.Phase {
+	case argov1alpha1.WorkflowUnknown, argov1alpha1.WorkflowPending, argov1alpha1.WorkflowRunning:
+		return true
+	default:
+		return false
+	}
+}
+
+func getTemplatesFromWorkflow(obj interface{}) []argov1alpha1.Template {
+	wf := obj.(*argov1alpha1.Workflow)
+
+	if !isWorkflowInFlight(wf) {
+		return nil
+	}
+
+	templates := append([]argov1alpha1.Template{}, wf.Spec.Templates...)
+
+	// Workflows submitted from a workflowTemplateRef have an empty spec until the controller
+	// stores the resolved spec in the status, as do templates resolved through a templateRef.
+	if wf.Status.StoredWorkflowSpec != nil {
+		templates = append(templates, wf.Status.StoredWorkflowSpec.Templates...)
+	}
+
+	for _, t := range wf.Status.StoredTemplates {
+		templates = append(templates, t)
+	}
+
+	return templates
+}
+
+func getWorkflowTemplateRefFromWorkflow(obj interface{}) *argov1alpha1.WorkflowTemplateRef {
+	wf := obj.(*argov1alpha1.Workflow)
+
+	if !isWorkflowInFlight(wf) {
+		return nil
+	}
+
+	return wf.Spec.WorkflowTemplateRef
+}
+
+func getArgumentsFromWorkflow(obj interface{}) argov1alpha1.Arguments {
+	wf := obj.(*argov1alpha1.Workflow)
+	arguments := *wf.Spec.Arguments.DeepCopy()
+
+	if wf.Status.StoredWorkflowSpec != nil {
+		arguments.Parameters = append(arguments.Parameters, wf.Status.StoredWorkflowSpec.Arguments.Parameters...)
+	}
+
+	return arguments
+}
+
+func NewWorkflowSource(client argoclientset.Interface, resyncPeriod time.Duration, optFns ...ArgoOptFn) ImageSource {
+	opts := &ArgoTemplateSourceOpts{
+		sourceName: "Workflow",
+		namespacedInformer: func(namespace string) cache.SharedIndexInformer {
+			fac := argoinformers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, argoinformers.WithNamespace(namespace), argoinformers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.LabelSelector = incompleteWorkflowSelector
+			}))
+
+			return fac.Argoproj().V1alpha1().Workflows().Informer()
+		},
+		extractTemplatesFromObject:           getTemplatesFromWorkflow,
+		extractWorkflowTemplateRefFromObject: getWorkflowTemplateRefFromWorkflow,
+		extractArgumentsFromObject:           getArgumentsFromWorkflow,
+		client:                               client,
+		resyncPeriod:                         resyncPeriod,
+	}
+
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return NewArgoTemplateSource(opts)
+}
@@ -0,0 +1,139 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	fake "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	"github.com/dcherman/image-cache-daemon/source"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func workflowWithImages(name string, phase argov1alpha1.WorkflowPhase, images ...string) argov1alpha1.Workflow {
+	var templates []argov1alpha1.Template
+
+	for _, image := range images {
+		templates = append(templates, argov1alpha1.Template{
+			Container: &v1.Container{
+				Image: image,
+			},
+		})
+	}
+
+	return argov1alpha1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.WorkflowSpec{
+			Templates: templates,
+		},
+		Status: argov1alpha1.WorkflowStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func Test_WorkflowSource_InFlight(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	submitted := workflowWithImages("submitted", argov1alpha1.WorkflowUnknown, "alpine")
+	pending := workflowWithImages("pending", argov1alpha1.WorkflowPending, "debian")
+	running := workflowWithImages("running", argov1alpha1.WorkflowRunning, "ubuntu")
+	succeeded := workflowWithImages("succeeded", argov1alpha1.WorkflowSucceeded, "centos")
+	failed := workflowWithImages("failed", argov1alpha1.WorkflowFailed, "fedora")
+
+	fakeClient := fake.NewSimpleClientset(&submitted, &pending, &running, &succeeded, &failed)
+	src := source.NewWorkflowSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian", "ubuntu"})
+}
+
+func Test_WorkflowSource_StoredTemplates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflow := workflowWithImages("workflow", argov1alpha1.WorkflowRunning)
+	workflow.Spec.WorkflowTemplateRef = &argov1alpha1.WorkflowTemplateRef{
+		Name: "template",
+	}
+	workflow.Status.StoredWorkflowSpec = &argov1alpha1.WorkflowSpec{
+		Templates: []argov1alpha1.Template{
+			{
+				Container: &v1.Container{
+					Image: "alpine",
+				},
+			},
+		},
+	}
+	workflow.Status.StoredTemplates = map[string]argov1alpha1.Template{
+		"namespaced/other/main": {
+			Script: &argov1alpha1.ScriptTemplate{
+				Container: v1.Container{
+					Image: "debian",
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflow)
+	src := source.NewWorkflowSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_WorkflowSource_Complete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflow := workflowWithImages("workflow", argov1alpha1.WorkflowRunning, "alpine", "debian")
+	otherWorkflow := workflowWithImages("other", argov1alpha1.WorkflowRunning, "debian")
+
+	fakeClient := fake.NewSimpleClientset(&workflow, &otherWorkflow)
+	src := source.NewWorkflowSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	argoSource := src.(*source.ArgoTemplateSource)
+
+	for !argoSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	workflow.Status.Phase = argov1alpha1.WorkflowSucceeded
+
+	_, err := fakeClient.ArgoprojV1alpha1().Workflows("default").Update(ctx, &workflow, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"debian"})
+}
+
+func Test_WorkflowSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewWorkflowSource(fakeClient, time.Minute*15)
+
+	assert.Equal(t, "Workflow", src.Name())
+}
@@ -6,19 +6,31 @@ import (
 	argov1alpha1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	argoclientset "github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	argoinformers "github.com/argoproj/argo-workflows/v3/pkg/client/informers/externalversions"
+	"k8s.io/client-go/tools/cache"
 )
 
-func NewWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration) ImageSource {
-	fac := argoinformers.NewSharedInformerFactory(client, resyncPeriod)
-
-	return NewArgoTemplateSource(&ArgoTemplateSourceOpts{
+func NewWorkflowTemplateSource(client argoclientset.Interface, resyncPeriod time.Duration, optFns ...ArgoOptFn) ImageSource {
+	opts := &ArgoTemplateSourceOpts{
 		sourceName: "WorkflowTemplate",
-		informer:   fac.Argoproj().V1alpha1().WorkflowTemplates().Informer(),
+		namespacedInformer: func(namespace string) cache.SharedIndexInformer {
+			fac := argoinformers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, argoinformers.WithNamespace(namespace))
+			return fac.Argoproj().V1alpha1().WorkflowTemplates().Informer()
+		},
 		extractTemplatesFromObject: func(obj interface{}) []argov1alpha1.Template {
 			tmpl := obj.(*argov1alpha1.WorkflowTemplate)
 			return tmpl.Spec.WorkflowSpec.Templates
 		},
+		extractArgumentsFromObject: func(obj interface{}) argov1alpha1.Arguments {
+			tmpl := obj.(*argov1alpha1.WorkflowTemplate)
+			return tmpl.Spec.WorkflowSpec.Arguments
+		},
 		client:       client,
 		resyncPeriod: resyncPeriod,
-	})
+	}
+
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return NewArgoTemplateSource(opts)
 }
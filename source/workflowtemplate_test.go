@@ -42,14 +42,10 @@ func Test_WorkflowTemplateSource_Containers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -97,14 +93,10 @@ func Test_WorkflowTemplateSource_Modify(t *testing.T) {
 	_, err := fakeClient.ArgoprojV1alpha1().WorkflowTemplates("default").Update(ctx, &workflowTemplate, metav1.UpdateOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"ubuntu", "debian"})
 }
 
@@ -150,17 +142,64 @@ func Test_WorkflowTemplateSource_Delete(t *testing.T) {
 	err := fakeClient.ArgoprojV1alpha1().WorkflowTemplates("default").Delete(ctx, "test", metav1.DeleteOptions{})
 	assert.NoError(t, err)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{})
 }
 
+func Test_WorkflowTemplateSource_RemovedEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Container: &v1.Container{
+							Image: "alpine",
+						},
+					},
+					{
+						Container: &v1.Container{
+							Image: "debian",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	argoSource := src.(*source.ArgoTemplateSource)
+
+	for !argoSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	workflowTemplate.Spec.Templates = workflowTemplate.Spec.Templates[1:]
+
+	_, err := fakeClient.ArgoprojV1alpha1().WorkflowTemplates("default").Update(ctx, &workflowTemplate, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := imageEvents(src)
+
+	assert.Contains(t, received, source.ImageEvent{Type: source.ImageRemoved, Image: "alpine", Source: src.Name(), Object: "default/test"})
+	assert.NotContains(t, received, source.ImageEvent{Type: source.ImageRemoved, Image: "debian", Source: src.Name(), Object: "default/test"})
+	assert.ElementsMatch(t, src.Images(), []string{"debian"})
+}
+
 func Test_WorkflowTemplateSource_Scripts(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
 
@@ -200,14 +239,10 @@ func Test_WorkflowTemplateSource_Scripts(t *testing.T) {
 		time.Sleep(time.Millisecond * 10)
 	}
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -244,14 +279,10 @@ func Test_WorkflowTemplateSource_InitContainers(t *testing.T) {
 
 	go src.Run(ctx)
 
-	var received []string
-
-	for image := range src.ImageCh() {
-		received = append(received, image)
-	}
+	received := addedImages(src)
 
 	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
-	assert.Len(t, src.ImageCh(), 0)
+	assert.Len(t, src.Events(), 0)
 	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
 }
 
@@ -261,3 +292,324 @@ func Test_WorkflowTemplateSource_Name(t *testing.T) {
 
 	assert.Equal(t, "WorkflowTemplate", src.Name())
 }
+
+func Test_WorkflowTemplateSource_Parameters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	tag := argov1alpha1.AnyString("3.14")
+	imageDefault := argov1alpha1.AnyString("debian:{{workflow.parameters.tag}}")
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Arguments: argov1alpha1.Arguments{
+					Parameters: []argov1alpha1.Parameter{
+						{
+							Name:  "tag",
+							Value: &tag,
+						},
+					},
+				},
+				Templates: []argov1alpha1.Template{
+					{
+						Container: &v1.Container{
+							Image: "alpine:{{workflow.parameters.tag}}",
+						},
+					},
+					{
+						Inputs: argov1alpha1.Inputs{
+							Parameters: []argov1alpha1.Parameter{
+								{
+									Name:    "image",
+									Default: &imageDefault,
+								},
+							},
+						},
+						Script: &argov1alpha1.ScriptTemplate{
+							Container: v1.Container{
+								Image: "{{ inputs.parameters.image }}",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine:3.14", "debian:3.14"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine:3.14", "debian:3.14"})
+}
+
+func Test_WorkflowTemplateSource_ParameterEnum(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Arguments: argov1alpha1.Arguments{
+					Parameters: []argov1alpha1.Parameter{
+						{
+							Name: "distro",
+							Enum: []argov1alpha1.AnyString{"alpine", "debian"},
+						},
+						{
+							Name: "tag",
+							Enum: []argov1alpha1.AnyString{"1", "2"},
+						},
+					},
+				},
+				Templates: []argov1alpha1.Template{
+					{
+						Container: &v1.Container{
+							Image: "{{=workflow.parameters.distro}}:{{workflow.parameters.tag}}",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine:1", "alpine:2", "debian:1", "debian:2"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_WorkflowTemplateSource_UnresolvedParameters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Container: &v1.Container{
+							Image: "alpine",
+						},
+					},
+					{
+						Container: &v1.Container{
+							Image: "{{workflow.parameters.missing}}",
+						},
+					},
+					{
+						Container: &v1.Container{
+							Image: "{{item}}",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine"})
+}
+
+func Test_WorkflowTemplateSource_Sidecars(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Sidecars: []argov1alpha1.UserContainer{
+							{
+								Container: v1.Container{
+									Image: "alpine",
+								},
+							},
+						},
+						Container: &v1.Container{
+							Image: "debian",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_WorkflowTemplateSource_Inline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Steps: []argov1alpha1.ParallelSteps{
+							{
+								Steps: []argov1alpha1.WorkflowStep{
+									{
+										Inline: &argov1alpha1.Template{
+											Container: &v1.Container{
+												Image: "alpine",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					{
+						DAG: &argov1alpha1.DAGTemplate{
+							Tasks: []argov1alpha1.DAGTask{
+								{
+									Inline: &argov1alpha1.Template{
+										Script: &argov1alpha1.ScriptTemplate{
+											Container: v1.Container{
+												Image: "debian",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian"})
+}
+
+func Test_WorkflowTemplateSource_Resources(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	workflowTemplate := argov1alpha1.WorkflowTemplate{
+		Spec: argov1alpha1.WorkflowTemplateSpec{
+			WorkflowSpec: argov1alpha1.WorkflowSpec{
+				Templates: []argov1alpha1.Template{
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  generateName: pod-
+spec:
+  containers:
+  - name: main
+    image: alpine
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: job-
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: debian
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "apply",
+							Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: main
+        image: ubuntu
+`,
+						},
+					},
+					{
+						Resource: &argov1alpha1.ResourceTemplate{
+							Action: "create",
+							Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: configmap
+data:
+  image: centos
+`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&workflowTemplate)
+	src := source.NewWorkflowTemplateSource(fakeClient, time.Minute*15)
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "busybox", "ubuntu"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine", "debian", "busybox", "ubuntu"})
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+func getImagesFromWorkload(obj interface{}) (map[string]bool, error) {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return getImageSetFromPodSpec(&workload.Spec.Template.Spec), nil
+	case *appsv1.StatefulSet:
+		return getImageSetFromPodSpec(&workload.Spec.Template.Spec), nil
+	case *appsv1.DaemonSet:
+		return getImageSetFromPodSpec(&workload.Spec.Template.Spec), nil
+	case *appsv1.ReplicaSet:
+		// Deployments keep old ReplicaSets around scaled down to zero as revision history.  Those
+		// images are no longer running anywhere, so don't keep them cached.
+		if workload.Spec.Replicas != nil && *workload.Spec.Replicas == 0 {
+			return map[string]bool{}, nil
+		}
+
+		return getImageSetFromPodSpec(&workload.Spec.Template.Spec), nil
+	default:
+		return nil, fmt.Errorf("could not cast input to a supported workload type, got %T", obj)
+	}
+}
+
+// NewWorkloadSource creates a source that emits the images of every Deployment, StatefulSet, DaemonSet
+// and scaled up ReplicaSet matching the label selector, which panics if it is invalid
+func NewWorkloadSource(client kubernetes.Interface, resyncPeriod time.Duration, selector string) ImageSource {
+	parsed, err := labels.Parse(selector)
+
+	if err != nil {
+		panic(err)
+	}
+
+	selector = parsed.String()
+
+	return NewInformerSource(&InformerSourceOpts{
+		sourceName: "Workload",
+		namespacedInformers: func(namespace string) []imageInformer {
+			fac := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(lo *v1.ListOptions) {
+				lo.LabelSelector = selector
+			}))
+
+			return newImageInformers(getImagesFromWorkload,
+				fac.Apps().V1().Deployments().Informer(),
+				fac.Apps().V1().StatefulSets().Informer(),
+				fac.Apps().V1().DaemonSets().Informer(),
+				fac.Apps().V1().ReplicaSets().Informer(),
+			)
+		},
+		resyncPeriod: resyncPeriod,
+	})
+}
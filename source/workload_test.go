@@ -0,0 +1,289 @@
+package source_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/dcherman/image-cache-daemon/source"
+)
+
+func podTemplateWithImages(images ...string) corev1.PodTemplateSpec {
+	var containers []corev1.Container
+
+	for _, image := range images {
+		containers = append(containers, corev1.Container{
+			Image: image,
+		})
+	}
+
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: containers,
+		},
+	}
+}
+
+func Test_WorkloadSource_Defaults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	var zero int32
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deployment",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Image: "busybox",
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Image: "alpine",
+						},
+					},
+					EphemeralContainers: []corev1.EphemeralContainer{
+						{
+							EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+								Image: "nicolaka/netshoot",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	statefulSet := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "statefulset",
+			Namespace: "default",
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: podTemplateWithImages("debian"),
+		},
+	}
+
+	daemonSet := appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "daemonset",
+			Namespace: "default",
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Template: podTemplateWithImages("ubuntu"),
+		},
+	}
+
+	replicaSet := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "replicaset",
+			Namespace: "default",
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: podTemplateWithImages("centos"),
+		},
+	}
+
+	scaledDownReplicaSet := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "replicaset-old",
+			Namespace: "default",
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &zero,
+			Template: podTemplateWithImages("fedora"),
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&deployment, &statefulSet, &daemonSet, &replicaSet, &scaledDownReplicaSet)
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"busybox", "alpine", "nicolaka/netshoot", "debian", "ubuntu", "centos"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"busybox", "alpine", "nicolaka/netshoot", "debian", "ubuntu", "centos"})
+}
+
+func Test_WorkloadSource_Selector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	participatingDeployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deployment-1",
+			Namespace: "default",
+			Labels: map[string]string{
+				"cache": "true",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: podTemplateWithImages("alpine"),
+		},
+	}
+
+	nonParticipatingDeployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deployment-2",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: podTemplateWithImages("debian"),
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&participatingDeployment, &nonParticipatingDeployment)
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "cache=true")
+
+	go src.Run(ctx)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine"})
+	assert.Len(t, src.Events(), 0)
+}
+
+func Test_WorkloadSource_Modify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deployment",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: podTemplateWithImages("alpine", "debian"),
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&deployment)
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	workloadSource := src.(*source.InformerSource)
+
+	for !workloadSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	deployment.Spec.Template.Spec.Containers[0].Image = "ubuntu"
+
+	_, err := fakeClient.AppsV1().Deployments("default").Update(ctx, &deployment, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian", "ubuntu"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"ubuntu", "debian"})
+}
+
+func Test_WorkloadSource_Delete(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deployment",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: podTemplateWithImages("alpine"),
+		},
+	}
+
+	statefulSet := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "statefulset",
+			Namespace: "default",
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Template: podTemplateWithImages("alpine", "debian"),
+		},
+	}
+
+	fakeClient := fake.NewSimpleClientset(&deployment, &statefulSet)
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "")
+
+	go src.Run(ctx)
+
+	workloadSource := src.(*source.InformerSource)
+
+	for !workloadSource.HasSynced() {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err := fakeClient.AppsV1().StatefulSets("default").Delete(ctx, "statefulset", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	received := addedImages(src)
+
+	assert.ElementsMatch(t, received, []string{"alpine", "debian"})
+	assert.Len(t, src.Events(), 0)
+	assert.ElementsMatch(t, src.Images(), []string{"alpine"})
+}
+
+func Test_WorkloadSource_Name(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "")
+
+	assert.Equal(t, "Workload", src.Name())
+}
+
+func Test_WorkloadSource_SetBasedSelector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+
+	t.Cleanup(cancel)
+
+	deployment := func(name, tier, image string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"tier": tier},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: podTemplateWithImages(image),
+			},
+		}
+	}
+
+	fakeClient := fake.NewSimpleClientset(
+		deployment("web", "web", "nginx"),
+		deployment("api", "api", "golang"),
+		deployment("db", "db", "postgres"),
+	)
+
+	src := source.NewWorkloadSource(fakeClient, time.Minute*15, "tier in (web,api)")
+
+	go src.Run(ctx)
+
+	assert.ElementsMatch(t, []string{"nginx", "golang"}, addedImages(src))
+}
+
+func Test_WorkloadSource_InvalidSelector(t *testing.T) {
+	// An invalid --workload-selector fails at startup rather than when the informers list workloads
+	assert.Panics(t, func() {
+		source.NewWorkloadSource(fake.NewSimpleClientset(), time.Minute*15, "tier in (web")
+	})
+}
@@ -163,7 +163,7 @@ func (kpps *KubernetesPodPullStrategy) MonitorPods(ctx context.Context) {
 	informer.Run(ctx.Done())
 }
 
-func (kpps *KubernetesPodPullStrategy) PullImage(ctx context.Context, image string) error {
+func (kpps *KubernetesPodPullStrategy) PullImage(ctx context.Context, image string, pullPolicy coreapiv1.PullPolicy) error {
 	createdPod, err := kpps.Client.CoreV1().Pods(kpps.Namespace).Create(ctx, &coreapiv1.Pod{
 		ObjectMeta: v1.ObjectMeta{
 			GenerateName: kpps.PodName + "-",
@@ -201,7 +201,7 @@ func (kpps *KubernetesPodPullStrategy) PullImage(ctx context.Context, image stri
 				{
 					Name:            "main",
 					Image:           image,
-					ImagePullPolicy: coreapiv1.PullAlways,
+					ImagePullPolicy: pullPolicy,
 					// warden is a simple statically compiled binary that does absolutely nothing.
 					// the idea behind it is by mounting it on an emptyDir and setting it as the entry
 					// point for the image we're pulling, we can successfully exit without actually doing
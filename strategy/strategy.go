@@ -2,10 +2,12 @@ package strategy
 
 import (
 	"context"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 type PullStrategy interface {
-	PullImage(context.Context, string) error
+	PullImage(ctx context.Context, image string, pullPolicy corev1.PullPolicy) error
 
 	ImagePullSuccessCh() <-chan string
 	ImagePullErrorCh() <-chan string